@@ -2,34 +2,92 @@ package api
 
 import (
 	mycache "TDKCache/cache"
+	"TDKCache/peers"
 	"TDKCache/service/http_resp"
 	"TDKCache/service/log"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
+// 响应头中记录key剩余存活时间(毫秒)的字段,0表示永不过期
+const ttlHeader = "X-TDKCache-TTL"
+
+// 响应头中记录key版本号的字段,用于CAS
+const versionHeader = "X-TDKCache-Version"
+
 var logger *log.LogEntry
 
+// multiGetItem 是批量获取响应中单个key的结果,value为base64编码
+type multiGetItem struct {
+	Key      string `json:"key"`
+	Value    []byte `json:"value,omitempty"`
+	TTL      int64  `json:"ttl"`
+	NotFound bool   `json:"not_found,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// keyItem 是key列表中单个key的信息
+type keyItem struct {
+	Key    string `json:"key"`
+	Size   int    `json:"size"`   // 值实际占用的字节数
+	Region string `json:"region"` // hot | cold
+	TTL    int64  `json:"ttl"`    // 剩余存活时间(毫秒),0表示永不过期
+}
+
+// keysResponse 是key列表的响应,cursor为空时表示遍历结束
+type keysResponse struct {
+	Keys   []keyItem `json:"keys"`
+	Cursor string    `json:"cursor,omitempty"`
+}
+
+// countResponse 是批量删除的响应
+type countResponse struct {
+	Count int `json:"count"` // 删除的key数量
+}
+
+// groupItem 是group列表中单个group的信息
+type groupItem struct {
+	Name  string        `json:"name"`
+	Stats mycache.Stats `json:"stats"`
+}
+
 type APIPool struct {
 	addr   string
 	router *httprouter.Router
 }
 
-func NewAPIPool(addr string) *APIPool {
+// NewAPIPool 创建api服务,通过api创建的group使用picker选择远程节点,picker可以为nil
+func NewAPIPool(addr string, picker peers.PeerPicker) *APIPool {
 	logger = log.NewLogger("API", fmt.Sprintf("Server <%s>", addr))
 	return &APIPool{
 		addr:   addr,
-		router: registerHandlers(),
+		router: registerHandlers(picker),
 	}
 }
 
-func registerHandlers() *httprouter.Router {
+func registerHandlers(picker peers.PeerPicker) *httprouter.Router {
 	router := httprouter.New()
 
 	router.GET("/TDKCache/Get", getGroupKeyHandler)
+	router.GET("/TDKCache/MGet", multiGetGroupKeysHandler)
 	router.GET("/TDKCache/Del", deleteGroupKeyHandler)
+	router.PUT("/TDKCache/Set", setGroupKeyHandler)
+	router.PUT("/TDKCache/CAS", casGroupKeyHandler)
+	router.PUT("/TDKCache/Incr", counterHandler(false))
+	router.PUT("/TDKCache/Decr", counterHandler(true))
+	router.DELETE("/TDKCache/Tag", invalidateTagHandler)
+	router.GET("/TDKCache/Admin/Keys", listGroupKeysHandler)
+	router.DELETE("/TDKCache/Admin/Keys", deleteGroupKeysHandler)
+	router.GET("/TDKCache/Admin/Groups", listGroupsHandler)
+	router.POST("/TDKCache/Admin/Groups", createGroupHandler(picker))
+	router.DELETE("/TDKCache/Admin/Groups", dropGroupHandler)
 	return router
 }
 
@@ -59,15 +117,338 @@ func getGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Par
 
 	logger.Info("%s GET -> get [group] %s | [key] %s", r.RemoteAddr, groupName, key)
 
-	view, err := group.Get(key)
+	var res mycache.Result
+	withVersion := values.Get("version") == "true"
+	if withVersion {
+		// 需要版本号时从负责该key的节点读取
+		res = group.GetVersioned(r.Context(), key)
+	} else {
+		res.Value, res.TTL, res.Err = group.GetWithTTLContext(r.Context(), key)
+	}
+	view, ttl, err := res.Value, res.TTL, res.Err
+	if mycache.IsNotFound(err) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorKeyUnexists)
+		return
+	} else if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(ttlHeader, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if withVersion {
+		w.Header().Set(versionHeader, strconv.FormatUint(res.Version, 10))
+	}
+	view.WriteTo(w)
+}
+
+// multiGetGroupKeysHandler 批量获取多个key,key参数可以重复出现,
+// 返回与key参数一一对应的JSON数组
+func multiGetGroupKeysHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	keys := values["key"]
+	if len(keys) == 0 {
+		logger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	logger.Info("%s GET -> multi get [group] %s | %d keys", r.RemoteAddr, groupName, len(keys))
+
+	results := group.GetMultiContext(r.Context(), keys)
+	items := make([]multiGetItem, len(results))
+	for i, res := range results {
+		items[i] = multiGetItem{Key: res.Key}
+		switch {
+		case mycache.IsNotFound(res.Err):
+			items[i].NotFound = true
+		case res.Err != nil:
+			items[i].Error = res.Err.Error()
+		default:
+			items[i].Value = res.Value.UnsafeBytes()
+			items[i].TTL = res.TTL.Milliseconds()
+		}
+	}
+
+	body, err := json.Marshal(items)
+	if err != nil {
+		logger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// setGroupKeyHandler 将请求体作为key的值写入集群,
+// 可选参数ttl为存活时间(毫秒),未指定时使用默认的过期时间,tag参数可以重复出现,为key设置多个标签
+func setGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		logger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	var ttl int64
+	if s := values.Get("ttl"); s != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(s, 10, 64); err != nil || ttl < 0 {
+			logger.Error("invalid param [ttl]: %s", s)
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	value, err := io.ReadAll(r.Body)
 	if err != nil {
+		logger.Error("reading request body: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	}
+
+	logger.Info("%s PUT -> set [group] %s | [key] %s", r.RemoteAddr, groupName, key)
+
+	if err = group.SetWithTagsContext(r.Context(), key, value, time.Duration(ttl)*time.Millisecond, values["tag"]); errors.Is(err, mycache.ErrReservedKey) {
+		logger.Error("invalid param [key]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
 		logger.Error("Internal error: %v", err)
 		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view.ByteSlice())
+	w.Write([]byte("ok"))
+}
+
+// casGroupKeyHandler 在key的版本号等于version时将请求体写入key,
+// version为0表示key必须不存在.成功时在响应头中返回新的版本号,版本号不匹配时返回409
+func casGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		logger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	version, err := strconv.ParseUint(values.Get("version"), 10, 64)
+	if err != nil {
+		logger.Error("invalid param [version]: %s", values.Get("version"))
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	var ttl int64
+	if s := values.Get("ttl"); s != "" {
+		if ttl, err = strconv.ParseInt(s, 10, 64); err != nil || ttl < 0 {
+			logger.Error("invalid param [ttl]: %s", s)
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("reading request body: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	}
+
+	logger.Info("%s PUT -> cas [group] %s | [key] %s | [version] %d", r.RemoteAddr, groupName, key, version)
+
+	version, err = group.CompareAndSwapContext(r.Context(), key, version, value, time.Duration(ttl)*time.Millisecond)
+	if errors.Is(err, mycache.ErrVersionConflict) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorVersionConflict)
+		return
+	} else if errors.Is(err, mycache.ErrReservedKey) {
+		logger.Error("invalid param [key]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(versionHeader, strconv.FormatUint(version, 10))
+	w.Write([]byte("ok"))
+}
+
+// counterHandler 返回Incr或Decr的处理函数,响应体为计算后的十进制整数.
+// 可选参数delta默认为1,initial为key不存在时的初始值,ttl为key不存在时的存活时间(毫秒)
+func counterHandler(decr bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		values := r.URL.Query()
+
+		groupName := values.Get("group")
+		if groupName == "" {
+			logger.Error("lack of necessary param [group]")
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+
+		key := values.Get("key")
+		if key == "" {
+			logger.Error("lack of necessary param [key]")
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+
+		delta, initial, ttl := int64(1), int64(0), int64(0)
+		var err error
+		if s := values.Get("delta"); s != "" {
+			if delta, err = strconv.ParseInt(s, 10, 64); err != nil {
+				logger.Error("invalid param [delta]: %s", s)
+				http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+				return
+			}
+		}
+		if s := values.Get("initial"); s != "" {
+			if initial, err = strconv.ParseInt(s, 10, 64); err != nil {
+				logger.Error("invalid param [initial]: %s", s)
+				http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+				return
+			}
+		}
+		if s := values.Get("ttl"); s != "" {
+			if ttl, err = strconv.ParseInt(s, 10, 64); err != nil || ttl < 0 {
+				logger.Error("invalid param [ttl]: %s", s)
+				http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+				return
+			}
+		}
+
+		group := mycache.GetGroup(groupName)
+		if group == nil {
+			logger.Error("no such group: %s", groupName)
+			http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+			return
+		}
+
+		var n int64
+		if decr {
+			logger.Info("%s PUT -> decr [group] %s | [key] %s | [delta] %d", r.RemoteAddr, groupName, key, delta)
+			n, err = group.DecrContext(r.Context(), key, delta, initial, time.Duration(ttl)*time.Millisecond)
+		} else {
+			logger.Info("%s PUT -> incr [group] %s | [key] %s | [delta] %d", r.RemoteAddr, groupName, key, delta)
+			n, err = group.IncrContext(r.Context(), key, delta, initial, time.Duration(ttl)*time.Millisecond)
+		}
+		if errors.Is(err, mycache.ErrNotInteger) {
+			http_resp.SendErrorResponse(w, http_resp.ErrorNotInteger)
+			return
+		} else if errors.Is(err, mycache.ErrCounterOverflow) {
+			http_resp.SendErrorResponse(w, http_resp.ErrorCounterOverflow)
+			return
+		} else if errors.Is(err, mycache.ErrReservedKey) {
+			logger.Error("invalid param [key]: %v", err)
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		} else if err != nil {
+			logger.Error("Internal error: %v", err)
+			http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(strconv.AppendInt(nil, n, 10))
+	}
+}
+
+// invalidateTagHandler 删除所有节点中带有tag的key,返回删除的key数量
+func invalidateTagHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	tag := values.Get("tag")
+	if tag == "" {
+		logger.Error("lack of necessary param [tag]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	logger.Info("%s DELETE -> invalidate [group] %s | [tag] %s", r.RemoteAddr, groupName, tag)
+
+	n, err := group.InvalidateTagContext(r.Context(), tag)
+	if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := json.Marshal(countResponse{Count: n})
+	if err != nil {
+		logger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
 }
 
 func deleteGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -96,8 +477,239 @@ func deleteGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.
 
 	logger.Info("%s GET -> delete [group] %s | [key] %s", r.RemoteAddr, groupName, key)
 
-	err := group.Delete(key)
+	var err error
+	if everywhere, _ := strconv.ParseBool(values.Get("everywhere")); everywhere {
+		// 删除所有节点中的key,包括各节点的热点副本
+		err = group.DeleteEverywhereContext(r.Context(), key)
+	} else {
+		err = group.DeleteContext(r.Context(), key)
+	}
+	if errors.Is(err, mycache.ErrReservedKey) {
+		logger.Error("invalid param [key]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write([]byte("ok"))
+}
+
+// deleteGroupKeysHandler 删除所有节点中以prefix开头或者匹配glob模式pattern的key,
+// prefix和pattern只能指定一个,返回删除的key数量
+func deleteGroupKeysHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	prefix, pattern := values.Get("prefix"), values.Get("pattern")
+	if (prefix == "") == (pattern == "") {
+		logger.Error("exactly one of params [prefix] and [pattern] is required")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if prefix != "" {
+		logger.Info("%s DELETE -> delete [group] %s | [prefix] %s", r.RemoteAddr, groupName, prefix)
+		n, err = group.DeletePrefixContext(r.Context(), prefix)
+	} else {
+		logger.Info("%s DELETE -> delete [group] %s | [pattern] %s", r.RemoteAddr, groupName, pattern)
+		n, err = group.DeletePatternContext(r.Context(), pattern)
+	}
+	if errors.Is(err, mycache.ErrInvalidPattern) {
+		logger.Error("invalid param [pattern]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := json.Marshal(countResponse{Count: n})
 	if err != nil {
+		logger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// listGroupKeysHandler 列出以prefix开头的key,通过cursor分页,limit为每页的数量.
+// everywhere=true时列出所有节点中的key,每个节点最多limit个,不支持分页
+func listGroupKeysHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		logger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	limit := 0
+	if s := values.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			logger.Error("invalid param [limit]: %s", s)
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	prefix := values.Get("prefix")
+	logger.Info("%s GET -> list keys [group] %s | [prefix] %s", r.RemoteAddr, groupName, prefix)
+
+	var (
+		keys []mycache.KeyInfo
+		resp keysResponse
+		err  error
+	)
+	if everywhere, _ := strconv.ParseBool(values.Get("everywhere")); everywhere {
+		keys, err = group.ScanEverywhere(r.Context(), prefix, limit)
+	} else {
+		keys, resp.Cursor, err = group.Scan(prefix, values.Get("cursor"), limit)
+	}
+	if errors.Is(err, mycache.ErrInvalidCursor) {
+		logger.Error("invalid param [cursor]: %s", values.Get("cursor"))
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		logger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	resp.Keys = make([]keyItem, len(keys))
+	for i, k := range keys {
+		resp.Keys[i] = keyItem{Key: k.Key, Size: k.Size, Region: "cold", TTL: k.TTL.Milliseconds()}
+		if k.Hot {
+			resp.Keys[i].Region = "hot"
+		}
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		logger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// listGroupsHandler 列出本节点的所有group及其统计数据
+func listGroupsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	logger.Info("%s GET -> list groups", r.RemoteAddr)
+
+	names := mycache.ListGroups()
+	items := make([]groupItem, 0, len(names))
+	for _, name := range names {
+		// 列出之后group可能已经被删除
+		if group := mycache.GetGroup(name); group != nil {
+			items = append(items, groupItem{Name: name, Stats: group.Stats()})
+		}
+	}
+
+	body, err := json.Marshal(items)
+	if err != nil {
+		logger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// createGroupHandler 在本节点创建容量为capacity字节的group,其他参数使用配置文件中的值.
+// 创建的group没有数据源,数据只能通过Set写入,集群中的每个节点都需要创建同名的group
+func createGroupHandler(picker peers.PeerPicker) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		values := r.URL.Query()
+
+		groupName := values.Get("name")
+		if groupName == "" {
+			logger.Error("lack of necessary param [name]")
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+
+		capacity, err := strconv.ParseInt(values.Get("capacity"), 10, 64)
+		if err != nil || capacity <= 0 {
+			logger.Error("invalid param [capacity]: %s", values.Get("capacity"))
+			http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+			return
+		}
+
+		logger.Info("%s POST -> create [group] %s | [capacity] %d", r.RemoteAddr, groupName, capacity)
+
+		group, err := mycache.NewGroup(groupName, capacity, mycache.GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, &mycache.NotFoundError{Key: key}
+			}))
+		if errors.Is(err, mycache.ErrGroupExists) {
+			http_resp.SendErrorResponse(w, http_resp.ErrorGroupExists)
+			return
+		} else if err != nil {
+			logger.Error("Internal error: %v", err)
+			http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+			return
+		}
+		if picker != nil {
+			group.RegisterPeers(picker)
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("ok"))
+	}
+}
+
+// dropGroupHandler 关闭并删除本节点的group
+func dropGroupHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	groupName := r.URL.Query().Get("name")
+	if groupName == "" {
+		logger.Error("lack of necessary param [name]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	logger.Info("%s DELETE -> drop [group] %s", r.RemoteAddr, groupName)
+
+	if err := mycache.DestroyGroup(groupName); errors.Is(err, mycache.ErrGroupNotFound) {
+		logger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	} else if err != nil {
+		// group已经被删除,只是关闭追加日志失败
 		logger.Error("Internal error: %v", err)
 		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
 		return
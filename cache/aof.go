@@ -0,0 +1,477 @@
+package mycache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 追加日志文件格式:
+//
+//	header: magic "TDKA" | version uint16
+//	record: 记录长度 uint32 | op byte | key长度 uvarint | key |
+//	        [value长度 uvarint | value | 过期时间 varint(Unix毫秒) | ttl varint(毫秒) |
+//	        {标签数量 uvarint | (标签长度 uvarint | 标签)...}] | 记录的CRC32 uint32
+//
+// 只有opSet和opSetManifest记录包含方括号中的字段,花括号中的字段只在带有标签时存在,整数使用大端序.
+// 进程崩溃可能留下不完整的最后一条记录,重放时会截断到最后一条完整的记录.
+// 之后还有数据的损坏记录无法截断,打开日志时返回ErrAppendLogCorrupted
+const (
+	aofMagic   = "TDKA"
+	aofVersion = 1
+	aofExt     = ".aof"
+
+	opSet         = byte(1) // 写入
+	opDelete      = byte(2) // 删除
+	opExpire      = byte(3) // 过期
+	opSetManifest = byte(4) // 写入大对象的分块清单,格式与opSet相同
+
+	defaultCompactSize = 64 // 默认触发压缩的最小日志大小(MB)
+)
+
+// FsyncPolicy 是追加日志同步到磁盘的策略
+type FsyncPolicy int
+
+const (
+	FsyncEverySecond FsyncPolicy = iota // 每秒同步一次,最多丢失1秒的写入
+	FsyncAlways                         // 每次写入后同步
+	FsyncNever                          // 由操作系统决定何时同步
+)
+
+// ParseFsyncPolicy 解析配置中的同步策略: always, everysec, never
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch s {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec", "":
+		return FsyncEverySecond, nil
+	case "never":
+		return FsyncNever, nil
+	}
+	return 0, fmt.Errorf("unknown fsync policy: %s", s)
+}
+
+// ErrAppendLogCorrupted 表示追加日志中间的记录损坏
+var ErrAppendLogCorrupted = errors.New("append log corrupted")
+
+// aofRecord 是追加日志中的一条记录
+type aofRecord struct {
+	op       byte
+	key      string
+	value    []byte
+	expireAt time.Time
+	ttl      time.Duration
+	tags     []string
+}
+
+// setOp 返回写入记录的op,manifest表示写入的值是分块清单
+func setOp(manifest bool) byte {
+	if manifest {
+		return opSetManifest
+	}
+	return opSet
+}
+
+// isSet 判断记录是否是写入
+func (rec aofRecord) isSet() bool {
+	return rec.op == opSet || rec.op == opSetManifest
+}
+
+// appendLog 记录group中数据的写入,删除和过期,用于重启后恢复数据
+type appendLog struct {
+	mu        sync.Mutex
+	rewriteMu sync.Mutex // 同一时间只进行一次重写
+	path      string
+	f         *os.File
+	policy    FsyncPolicy
+	dirty     bool     // 有未同步到磁盘的写入
+	size      int64    // 当前日志大小
+	baseSize  int64    // 上次压缩后的日志大小
+	closed    bool     // 日志已经关闭
+	rewriting bool     // 正在重写日志
+	pending   [][]byte // 重写期间追加的记录,重写完成前写入新的日志
+}
+
+// aofPath 返回group的追加日志文件路径
+func aofPath(dir, name string) string {
+	return filepath.Join(dir, url.PathEscape(name)+aofExt)
+}
+
+// openAppendLog 打开追加日志并读取其中的记录,不完整或损坏的最后一条记录会被截断
+func openAppendLog(path string, policy FsyncPolicy) (*appendLog, []aofRecord, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, size, err := readAppendLog(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err = f.Truncate(size); err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err == nil && size == 0 {
+		// 新的日志文件
+		size, err = writeAOFHeader(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return &appendLog{path: path, f: f, policy: policy, size: size, baseSize: size}, records, nil
+}
+
+func writeAOFHeader(w io.Writer) (int64, error) {
+	header := make([]byte, len(aofMagic)+2)
+	copy(header, aofMagic)
+	binary.BigEndian.PutUint16(header[len(aofMagic):], aofVersion)
+	n, err := w.Write(header)
+	return int64(n), err
+}
+
+// readAppendLog 读取日志中所有完整的记录,返回记录以及完整记录结束的位置.
+// 最后一条记录不完整或损坏时忽略该记录,中间的记录损坏时返回ErrAppendLogCorrupted
+func readAppendLog(r io.Reader) ([]aofRecord, int64, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(aofMagic)+2)
+	if _, err := io.ReadFull(br, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		// 空文件或者写入文件头时崩溃
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	if string(header[:len(aofMagic)]) != aofMagic {
+		return nil, 0, errors.New("not an append log")
+	}
+	if v := binary.BigEndian.Uint16(header[len(aofMagic):]); v != aofVersion {
+		return nil, 0, fmt.Errorf("unsupported append log version: %d", v)
+	}
+
+	offset := int64(len(header))
+	var records []aofRecord
+	lenBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(br, lenBuf); err != nil {
+			break
+		}
+		n := binary.BigEndian.Uint32(lenBuf)
+		if n > maxSnapshotBytes {
+			return nil, 0, fmt.Errorf("%w: record length %d at offset %d", ErrAppendLogCorrupted, n, offset)
+		}
+		data := make([]byte, n+4)
+		if _, err := io.ReadFull(br, data); err != nil {
+			break
+		}
+		var rec aofRecord
+		err := ErrAppendLogCorrupted
+		if binary.BigEndian.Uint32(data[n:]) == crc32.ChecksumIEEE(data[:n]) {
+			rec, err = decodeAOFRecord(data[:n])
+		}
+		if err != nil {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				// 写入最后一条记录时崩溃
+				break
+			}
+			return nil, 0, fmt.Errorf("%w: bad record at offset %d", ErrAppendLogCorrupted, offset)
+		}
+		records = append(records, rec)
+		offset += int64(len(lenBuf)) + int64(len(data))
+	}
+	return records, offset, nil
+}
+
+func encodeAOFRecord(rec aofRecord) []byte {
+	buf := make([]byte, 4, 4+1+binary.MaxVarintLen64*4+len(rec.key)+len(rec.value)+4)
+	buf = append(buf, rec.op)
+	buf = binary.AppendUvarint(buf, uint64(len(rec.key)))
+	buf = append(buf, rec.key...)
+	if rec.isSet() {
+		buf = binary.AppendUvarint(buf, uint64(len(rec.value)))
+		buf = append(buf, rec.value...)
+		buf = binary.AppendVarint(buf, rec.expireAt.UnixMilli())
+		buf = binary.AppendVarint(buf, rec.ttl.Milliseconds())
+		if len(rec.tags) > 0 {
+			buf = binary.AppendUvarint(buf, uint64(len(rec.tags)))
+			for _, tag := range rec.tags {
+				buf = binary.AppendUvarint(buf, uint64(len(tag)))
+				buf = append(buf, tag...)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+}
+
+func decodeAOFRecord(data []byte) (aofRecord, error) {
+	var rec aofRecord
+	if len(data) == 0 {
+		return rec, ErrSnapshotCorrupted
+	}
+	rec.op, data = data[0], data[1:]
+	key, data, err := decodeAOFBytes(data)
+	if err != nil {
+		return rec, err
+	}
+	rec.key = string(key)
+	switch rec.op {
+	case opDelete, opExpire:
+		return rec, nil
+	case opSet, opSetManifest:
+	default:
+		return rec, ErrSnapshotCorrupted
+	}
+
+	if rec.value, data, err = decodeAOFBytes(data); err != nil {
+		return rec, err
+	}
+	expireAt, n := binary.Varint(data)
+	if n <= 0 {
+		return rec, ErrSnapshotCorrupted
+	}
+	ttl, m := binary.Varint(data[n:])
+	if m <= 0 {
+		return rec, ErrSnapshotCorrupted
+	}
+	rec.expireAt, rec.ttl = time.UnixMilli(expireAt), time.Duration(ttl)*time.Millisecond
+	if data = data[n+m:]; len(data) == 0 {
+		return rec, nil
+	}
+	count, k := binary.Uvarint(data)
+	if k <= 0 || count > uint64(len(data)) {
+		return rec, ErrSnapshotCorrupted
+	}
+	data = data[k:]
+	for i := uint64(0); i < count; i++ {
+		var tag []byte
+		if tag, data, err = decodeAOFBytes(data); err != nil {
+			return rec, err
+		}
+		rec.tags = append(rec.tags, string(tag))
+	}
+	return rec, nil
+}
+
+func decodeAOFBytes(data []byte) ([]byte, []byte, error) {
+	n, m := binary.Uvarint(data)
+	if m <= 0 || uint64(len(data)-m) < n {
+		return nil, nil, ErrSnapshotCorrupted
+	}
+	return data[m : m+int(n)], data[m+int(n):], nil
+}
+
+// append 写入一条记录,按照同步策略决定是否立即同步到磁盘
+func (l *appendLog) append(rec aofRecord) error {
+	data := encodeAOFRecord(rec)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	if _, err := l.f.Write(data); err != nil {
+		return err
+	}
+	if l.rewriting {
+		l.pending = append(l.pending, data)
+	}
+	l.size += int64(len(data))
+	if l.policy == FsyncAlways {
+		return l.f.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+// sync 将未同步的写入同步到磁盘,用于每秒同步的策略
+func (l *appendLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed || !l.dirty || l.policy == FsyncNever {
+		return nil
+	}
+	l.dirty = false
+	return l.f.Sync()
+}
+
+// needCompact 判断日志是否需要压缩: 日志超过minSize且比上次压缩后增长了一倍以上
+func (l *appendLog) needCompact(minSize int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size >= minSize && l.size >= 2*l.baseSize
+}
+
+// rewrite 使用records重写日志.读取records期间不持有锁,
+// 期间追加的记录同时写入旧的日志和pending,完成时追加到新的日志之后再替换旧的日志.
+// 调用方需要保证records包含开始重写之前的所有写入
+func (l *appendLog) rewrite(records func() []aofRecord) error {
+	l.rewriteMu.Lock()
+	defer l.rewriteMu.Unlock()
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return os.ErrClosed
+	}
+	l.rewriting, l.pending = true, nil
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.rewriting, l.pending = false, nil
+		l.mu.Unlock()
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	size, _ := writeAOFHeader(w)
+	for _, rec := range records() {
+		n, _ := w.Write(encodeAOFRecord(rec))
+		size += int64(n)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	// 重写期间的记录重放时覆盖records中较旧的数据
+	for _, data := range l.pending {
+		n, _ := w.Write(data)
+		size += int64(n)
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.f.Close()
+	l.f, l.size, l.baseSize, l.dirty = f, size, size, false
+	return nil
+}
+
+func (l *appendLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.policy != FsyncNever {
+		l.f.Sync()
+	}
+	return l.f.Close()
+}
+
+// logAppend 写入一条追加日志记录,由分片在持有锁时调用
+func (g *Group) logAppend(rec aofRecord) {
+	if g.aof == nil {
+		return
+	}
+	if err := g.aof.append(rec); err != nil {
+		groupLogger.Error("append log of group [%s]: %v", g.name, err)
+	}
+}
+
+// replayLog 按照日志中的记录恢复数据,跳过已经过期的数据
+func (g *Group) replayLog(records []aofRecord) int {
+	// 只需要恢复每个key最后的状态
+	last := make(map[string]aofRecord, len(records))
+	for _, rec := range records {
+		if rec.isSet() {
+			last[rec.key] = rec
+		} else {
+			delete(last, rec.key)
+		}
+	}
+	now := g.mainCache.clock.Now()
+	n := 0
+	for _, rec := range last {
+		e := snapshotEntry{key: rec.key, ttl: rec.ttl, remaining: rec.expireAt.Sub(now), tags: rec.tags, manifest: rec.op == opSetManifest}
+		if e.remaining <= 0 {
+			continue
+		}
+		e.value = g.restoredValue(rec.value, e.manifest)
+		if g.mainCache.shard(e.key).restore(e) {
+			n++
+		}
+	}
+	return n
+}
+
+// CompactLog 使用缓存中当前的数据重写追加日志,没有开启追加日志时什么都不做
+func (g *Group) CompactLog() error {
+	if g.aof == nil {
+		return nil
+	}
+	return g.aof.rewrite(func() []aofRecord {
+		now := g.mainCache.clock.Now()
+		var records []aofRecord
+		for _, s := range g.mainCache.shards {
+			for _, e := range s.snapshot() {
+				value, err := e.value.decompress()
+				if err != nil {
+					groupLogger.Error("skip key [%s] in append log: %v", e.key, err)
+					continue
+				}
+				records = append(records, aofRecord{
+					op:       setOp(e.manifest),
+					key:      e.key,
+					value:    value.bytes(),
+					expireAt: now.Add(e.remaining),
+					ttl:      e.ttl,
+					tags:     e.tags,
+				})
+			}
+		}
+		return records
+	})
+}
+
+// runAppendLog 每秒同步一次日志,并在日志增长过多时在后台压缩,group关闭时退出
+func (g *Group) runAppendLog(compactSize int64) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.stop:
+			return
+		}
+		if err := g.aof.sync(); err != nil {
+			groupLogger.Error("sync append log of group [%s]: %v", g.name, err)
+		}
+		if g.aof.needCompact(compactSize) {
+			if err := g.CompactLog(); err != nil {
+				groupLogger.Error("compact append log of group [%s]: %v", g.name, err)
+			}
+		}
+	}
+}
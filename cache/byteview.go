@@ -1,24 +1,185 @@
 package mycache
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ByteView 是缓存中只读的值,底层可以是[]byte或者string.
+// 开启压缩时缓存中的data保存压缩后的数据,访问数据的方法会先解压.
+// Group读取时只解压一次,返回的ByteView都是解压后的数据,访问时不需要再解压
 type ByteView struct {
-	data []byte
+	data  []byte
+	s     string // data为nil时使用s
+	codec Codec  // 压缩data使用的算法,为nil表示没有压缩
+	n     int    // 压缩前的长度
+}
+
+// StringView 返回以s为底层数据的ByteView,不会拷贝s
+func StringView(s string) ByteView {
+	return ByteView{s: s}
 }
 
 // Len 返回ByteView实例的字节长度
 func (v ByteView) Len() int {
-	return len(v.data)
+	if v.codec != nil {
+		return v.n
+	}
+	if v.data != nil {
+		return len(v.data)
+	}
+	return len(v.s)
 }
 
 // ByteSlice 返回ByteView实例的数据拷贝
 func (v ByteView) ByteSlice() []byte {
-	return cloneBytes(v.data)
+	v = v.plain()
+	if v.data != nil {
+		return cloneBytes(v.data)
+	}
+	return []byte(v.s)
 }
 
 // String 返回ByteView实例的字符串
 func (v ByteView) String() string {
+	v = v.plain()
+	if v.data == nil {
+		return v.s
+	}
 	return string(v.data)
 }
 
+// UnsafeBytes 返回底层数据而不拷贝,调用方不能修改返回的切片.
+// 用于将值直接写入响应,以string为底层数据时仍然需要拷贝
+func (v ByteView) UnsafeBytes() []byte {
+	return v.bytes()
+}
+
+// At 返回第i个字节
+func (v ByteView) At(i int) byte {
+	v = v.plain()
+	if v.data != nil {
+		return v.data[i]
+	}
+	return v.s[i]
+}
+
+// Slice 返回[from, to)之间的数据,与原ByteView共享底层数据
+func (v ByteView) Slice(from, to int) ByteView {
+	v = v.plain()
+	if v.data != nil {
+		return ByteView{data: v.data[from:to]}
+	}
+	return ByteView{s: v.s[from:to]}
+}
+
+// SliceFrom 返回从from开始的数据,与原ByteView共享底层数据
+func (v ByteView) SliceFrom(from int) ByteView {
+	return v.Slice(from, v.Len())
+}
+
+// Copy 将数据拷贝到dst,返回拷贝的字节数
+func (v ByteView) Copy(dst []byte) int {
+	v = v.plain()
+	if v.data != nil {
+		return copy(dst, v.data)
+	}
+	return copy(dst, v.s)
+}
+
+// Equal 判断两个ByteView的数据是否相同
+func (v ByteView) Equal(other ByteView) bool {
+	other = other.plain()
+	if other.data == nil {
+		return v.EqualString(other.s)
+	}
+	return v.EqualBytes(other.data)
+}
+
+// EqualString 判断数据是否与s相同
+func (v ByteView) EqualString(s string) bool {
+	v = v.plain()
+	if v.data == nil {
+		return v.s == s
+	}
+	return string(v.data) == s
+}
+
+// EqualBytes 判断数据是否与b相同
+func (v ByteView) EqualBytes(b []byte) bool {
+	v = v.plain()
+	if v.data != nil {
+		return bytes.Equal(v.data, b)
+	}
+	return v.s == string(b)
+}
+
+// Reader 返回读取数据的io.ReadSeeker,不会拷贝数据
+func (v ByteView) Reader() io.ReadSeeker {
+	v = v.plain()
+	if v.data != nil {
+		return bytes.NewReader(v.data)
+	}
+	return strings.NewReader(v.s)
+}
+
+// WriteTo 将数据写入w,不会拷贝数据
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	v = v.plain()
+	var (
+		n   int
+		err error
+	)
+	if v.data != nil {
+		n, err = w.Write(v.data)
+	} else {
+		n, err = io.WriteString(w, v.s)
+	}
+	return int64(n), err
+}
+
+// size 返回实际占用的字节数,用于计算缓存容量
+func (v ByteView) size() int {
+	if v.data != nil {
+		return len(v.data)
+	}
+	return len(v.s)
+}
+
+// decompress 返回解压后的ByteView,没有压缩时返回v本身.
+// 压缩的值只保存在缓存中,返回给调用方之前需要解压
+func (v ByteView) decompress() (ByteView, error) {
+	if v.codec == nil {
+		return v, nil
+	}
+	data, err := v.codec.Decompress(v.data)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("decompress value with %s: %w", v.codec.Name(), err)
+	}
+	return ByteView{data: data}, nil
+}
+
+// plain 返回解压后的ByteView,用于访问数据的方法.
+// 这些方法无法返回错误,压缩的数据损坏时panic,Group在返回之前已经解压并处理了错误
+func (v ByteView) plain() ByteView {
+	p, err := v.decompress()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// bytes 返回解压后的底层数据,调用方不能修改
+func (v ByteView) bytes() []byte {
+	v = v.plain()
+	if v.data == nil {
+		return []byte(v.s)
+	}
+	return v.data
+}
+
 func cloneBytes(data []byte) []byte {
 	c := make([]byte, len(data))
 	copy(c, data)
@@ -2,180 +2,633 @@ package mycache
 
 import (
 	"TDKCache/cache/lru"
+	"TDKCache/cache/timingwheel"
 	"TDKCache/service/conf"
 	"TDKCache/service/log"
+	"fmt"
+	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const deleteChanCap = 100
+const (
+	defaultExpireTick   = 100 // 默认过期检查间隔(毫秒)
+	defaultExpireBudget = 1000
+	defaultShards       = 16
+	// 默认负缓存存活时间(秒)
+	defaultNegativeExpireTime = 10
+	// 每个分片的最小容量,避免小容量的缓存被切分得过细
+	minShardCapacity = 1 << 10
+)
 
 var expireTime = time.Second * time.Duration(conf.Conf.GetInt64("cache.expireTime"))
 
+var (
+	// 后台过期检查的时间间隔
+	expireTick = confDuration("cache.expireTick", defaultExpireTick, time.Millisecond)
+	// 每个分片每次过期检查最多删除的key数量,避免长时间持有锁
+	expireBudget = confInt("cache.expireBudget", defaultExpireBudget)
+)
+
 var cacheLogger = log.NewLogger("Cache", "Cache")
 
-// 进行并发读写的封装
+// 进行并发读写的封装,缓存按照key的哈希值分为多个分片,每个分片独立加锁
 type cache struct {
-	lck      sync.Mutex   // 并发锁
-	lru      *lru.HCCache // lru缓存
-	cacheCap int64        // 缓存容量
-	exMap    *exprireMap  // 记录过期键的哈希表
+	shards      []*cacheShard     // 分片
+	mask        uint32            // 分片数量减1,分片数量为2的幂
+	cacheCap    int64             // 缓存容量
+	clock       timingwheel.Clock // 判断过期使用的时钟
+	negativeTTL time.Duration     // 负缓存的存活时间
+	refreshAt   float64           // 数据存活超过该比例的ttl后提前刷新
+	refreshBeta float64           // 概率提前刷新的系数
+	version     atomic.Uint64     // 最近一次写入的版本号
+	newPolicy   lru.NewPolicyFunc // 创建淘汰策略的函数,关闭时用于清空分片
+	stopChan    chan struct{}
+	stopOnce    sync.Once
+}
+
+// 缓存分片
+type cacheShard struct {
+	lck       sync.Mutex        // 并发锁
+	lru       lru.Policy        // 淘汰策略
+	exMap     *exprireMap       // 记录过期键的时间轮
+	tags      tagIndex          // 标签到key的索引
+	keys      *keyIndex         // 按照key排序的索引,用于Scan
+	clock     timingwheel.Clock // 判断过期使用的时钟
+	onEvicted EvictionCallback  // 数据被移出缓存时的回调函数
+	mode      ExpirationMode    // 过期模式
+	maxAge    time.Duration     // 写入后的最长存活时间
+	reason    EvictReason       // 当前删除数据的原因
+	events    []evictEvent      // 持有锁期间产生的回调,释放锁后执行
+	version   *atomic.Uint64    // 所有分片共用的版本号计数器
+	journal   func(aofRecord)   // 在持有锁时记录写入,删除和过期,可能为nil
+	// 分块清单被移出缓存后调用,用于删除清单引用的分块,可能为nil
+	onDropManifest func(key string, manifest []byte)
+}
+
+// EvictReason 表示数据被移出缓存的原因
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // 超出容量被淘汰
+	EvictExpired                     // 过期
+	EvictDeleted                     // 被删除
+	EvictReplaced                    // 被新的值替换
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	}
+	return "unknown"
+}
+
+// EvictionCallback 在数据被移出缓存后调用,调用时不持有缓存的锁
+type EvictionCallback func(key string, value ByteView, reason EvictReason)
+
+// item 是保存在淘汰策略中的数据
+type item struct {
+	view     ByteView      // 值
+	notFound bool          // 负缓存,表示key在数据源中不存在
+	loadedAt time.Time     // 写入缓存的时间
+	ttl      time.Duration // 写入时的存活时间
+	delta    time.Duration // 加载数据花费的时间
+	version  uint64        // 写入时分配的版本号,每次写入递增
+	tags     []string      // 标签,用于按标签删除
+	manifest bool          // 值是大对象的分块清单
+}
+
+// Len 返回值实际占用的字节数,压缩的值按照压缩后的大小计算
+func (it *item) Len() int {
+	return it.view.size()
+}
+
+type evictEvent struct {
+	key      string
+	value    ByteView
+	reason   EvictReason
+	manifest bool // 被移出的值是分块清单
 }
 
 type exprireMap struct {
-	timeMap      map[int64]map[string]struct{}
-	keyExpireMap map[string]int64
-	lck          sync.Mutex
-	stopChan     chan struct{}
+	wheel        *timingwheel.TimingWheel // 到期时删除key的时间轮
+	keyExpireMap map[string]expireInfo    // 以key为索引的过期信息
 }
 
-type deleteMsg struct {
-	keys []string
+// 单个key的过期信息
+type expireInfo struct {
+	at       time.Time     // 过期时间
+	ttl      time.Duration // key的存活时间
+	deadline time.Time     // 最晚的过期时间,零值表示没有限制
 }
 
-func NewExprireMap() *exprireMap {
+// ExpirationMode 决定key的过期时间如何计算
+type ExpirationMode int
+
+const (
+	// SlidingExpiration 每次访问后重新计算过期时间
+	SlidingExpiration ExpirationMode = iota
+	// AbsoluteExpiration 写入后经过存活时间过期,访问不会延长过期时间
+	AbsoluteExpiration
+	// SlidingExpirationWithMaxAge 每次访问后重新计算过期时间,但写入后最多存活maxAge
+	SlidingExpirationWithMaxAge
+)
+
+func NewExprireMap(now time.Time) *exprireMap {
 	return &exprireMap{
-		timeMap:      make(map[int64]map[string]struct{}),
-		keyExpireMap: make(map[string]int64),
-		lck:          sync.Mutex{},
-		stopChan:     make(chan struct{}),
+		wheel:        timingwheel.New(time.Millisecond, now),
+		keyExpireMap: make(map[string]expireInfo),
 	}
 }
 
-func NewCache(capacity int64, onEvicted func(key string, value lru.Value)) *cache {
+// setExpire 记录key的过期信息,调用者需要持有锁
+func (m *exprireMap) setExpire(key string, info expireInfo) {
+	if info.ttl <= 0 {
+		// 存活时间为0的key永不过期
+		m.removeExpire(key)
+		return
+	}
+
+	if !info.deadline.IsZero() && info.deadline.Before(info.at) {
+		info.at = info.deadline
+	}
+	m.keyExpireMap[key] = info
+	m.wheel.Add(key, info.at)
+}
+
+// removeExpire 删除key的过期记录,调用者需要持有锁
+func (m *exprireMap) removeExpire(key string) {
+	if _, ok := m.keyExpireMap[key]; ok {
+		m.wheel.Remove(key)
+		delete(m.keyExpireMap, key)
+	}
+}
+
+// expired 判断key在now时是否已经过期,调用者需要持有锁
+func (m *exprireMap) expired(key string, now time.Time) bool {
+	info, ok := m.keyExpireMap[key]
+	return ok && !now.Before(info.at)
+}
+
+// NewCache 创建缓存,onEvicted和通过WithEvictionCallback设置的回调函数都会在数据被移出缓存时调用
+func NewCache(capacity int64, onEvicted EvictionCallback, opts ...Option) *cache {
+	o := applyOptions(opts)
+	if len(o.callbacks) > 0 {
+		o.callbacks = []EvictionCallback{decompressed(chainCallbacks(o.callbacks))}
+	}
+	if onEvicted != nil {
+		o.callbacks = append([]EvictionCallback{onEvicted}, o.callbacks...)
+	}
+	n := shardCount(capacity, o.shards)
 	c := &cache{
-		lck:      sync.Mutex{},
-		lru:      lru.NewHCCache(capacity, onEvicted),
-		cacheCap: capacity,
-		exMap:    NewExprireMap(),
+		shards:      make([]*cacheShard, n),
+		mask:        uint32(n - 1),
+		cacheCap:    capacity,
+		clock:       o.clock,
+		stopChan:    make(chan struct{}),
+		negativeTTL: o.negativeTTL,
+		refreshAt:   o.refreshAt,
+		refreshBeta: o.refreshBeta,
+		newPolicy:   o.newPolicy,
 	}
-	go c.run(time.Now().Unix())
+	// 以当前时间作为初始版本号,重启后新分配的版本号仍然大于重启前的版本号
+	c.version.Store(uint64(time.Now().UnixNano()))
+	for i := range c.shards {
+		s := &cacheShard{
+			exMap:     NewExprireMap(o.clock.Now()),
+			tags:      make(tagIndex),
+			keys:      newKeyIndex(),
+			clock:     o.clock,
+			onEvicted: chainCallbacks(o.callbacks),
+			mode:      o.mode,
+			maxAge:    o.maxAge,
+			version:   &c.version,
+		}
+		s.lru = o.newPolicy(capacity/int64(n), s.evicted)
+		c.shards[i] = s
+	}
+	go c.run()
 	return c
 
 }
 
-func (c *cache) run(start int64) {
-	t := time.NewTicker(time.Second * 1)
-	defer t.Stop()
-
-	deleteChan := make(chan *deleteMsg, deleteChanCap)
+// chainCallbacks 将多个回调函数合并为一个,没有回调函数时返回nil
+func chainCallbacks(callbacks []EvictionCallback) EvictionCallback {
+	switch len(callbacks) {
+	case 0:
+		return nil
+	case 1:
+		return callbacks[0]
+	}
+	return func(key string, value ByteView, reason EvictReason) {
+		for _, fn := range callbacks {
+			fn(key, value, reason)
+		}
+	}
+}
 
-	go func() {
-		for v := range deleteChan {
-			c.multiDelete(v.keys)
+// decompressed 返回将值解压后再调用fn的回调函数,多个回调函数共用一次解压
+func decompressed(fn EvictionCallback) EvictionCallback {
+	return func(key string, value ByteView, reason EvictReason) {
+		v, err := value.decompress()
+		if err != nil {
+			cacheLogger.Error("evicted key [%s]: %v", key, err)
 		}
-	}()
+		fn(key, v, reason)
+	}
+}
+
+// shardCount 返回不超过want的最大的2的幂,并保证每个分片的容量不小于minShardCapacity
+func shardCount(capacity int64, want int) int {
+	if max := int(capacity / minShardCapacity); want > max {
+		want = max
+	}
+	n := 1
+	for n*2 <= want {
+		n *= 2
+	}
+	return n
+}
+
+// shard 返回key所在的分片
+func (c *cache) shard(key string) *cacheShard {
+	// 32位FNV-1a哈希
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h&c.mask]
+}
+
+func (c *cache) run() {
+	t := time.NewTicker(expireTick)
+	defer t.Stop()
 
 	for {
 		select {
 		case <-t.C:
-			start++
-			if len(c.exMap.timeMap[start]) > 0 {
-				keys := make([]string, 0, len(c.exMap.timeMap[start]))
-				for k := range c.exMap.timeMap[start] {
-					keys = append(keys, k)
-				}
-				cacheLogger.Debug("keys [%v] expire at %d", keys, start)
-
-				deleteChan <- &deleteMsg{keys: keys}
-			}
-		case <-c.exMap.stopChan:
-			close(deleteChan)
+			c.removeExpired()
+		case <-c.stopChan:
 			return
 		}
 	}
 
 }
 
-func (c *cache) add(key string, value ByteView) bool {
-	c.lck.Lock()
-	defer c.lck.Unlock()
-	t := time.Now().Unix()
-	if c.lru == nil {
-		c.lru = lru.NewHCCache(c.cacheCap, nil)
+// close 停止后台的过期检查,并丢弃所有分片中的数据,不会调用回调函数
+func (c *cache) close() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
+	for _, s := range c.shards {
+		s.lck.Lock()
+		s.lru = c.newPolicy(c.cacheCap/int64(len(c.shards)), s.evicted)
+		s.exMap = NewExprireMap(s.clock.Now())
+		s.tags = make(tagIndex)
+		s.keys = newKeyIndex()
+		s.events = nil
+		s.lck.Unlock()
 	}
-	c.exMap.lck.Lock()
-	defer c.exMap.lck.Unlock()
-	if exTime, ok := c.exMap.keyExpireMap[key]; ok {
-		delete(c.exMap.timeMap[exTime], key)
+}
+
+// removeExpired 删除所有分片中已经到期的key,返回删除的key数量
+func (c *cache) removeExpired() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.removeExpired()
 	}
+	return n
+}
 
-	c.exMap.keyExpireMap[key] = t + int64(expireTime)
-	keyMap, ok := c.exMap.timeMap[t+int64(expireTime)]
-	if !ok {
-		// 如果 map 不存在，进行初始化
-		keyMap = make(map[string]struct{})
-		c.exMap.timeMap[t+int64(expireTime)] = keyMap
+func (c *cache) add(key string, value ByteView, ttl time.Duration) bool {
+	return c.addItem(key, &item{view: value}, ttl)
+}
+
+// addNotFound 记录key在数据源中不存在,在负缓存过期前不再访问数据源.
+// key已经有未过期的值时不会被负缓存替换,例如提前刷新期间通过Set写入的值
+func (c *cache) addNotFound(key string) bool {
+	s := c.shard(key)
+	s.lck.Lock()
+	defer s.unlock()
+	if v, ok := s.lru.Peek(key); ok && !v.(*item).notFound && !s.exMap.expired(key, s.clock.Now()) {
+		return false
 	}
+	return s.addLocked(key, &item{notFound: true}, c.negativeTTL)
+}
 
-	// 添加元素到内层 map
-	keyMap[key] = struct{}{}
-	return c.lru.Add(key, value, t)
+func (c *cache) addItem(key string, it *item, ttl time.Duration) bool {
+	return c.shard(key).add(key, it, ttl)
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.lck.Lock()
-	defer c.lck.Unlock()
-	if c.lru == nil {
-		return
+// update 原子地更新key,见cacheShard.update
+func (c *cache) update(key string, fn func(old *item) (*item, time.Duration, error)) (*item, error) {
+	return c.shard(key).update(key, fn)
+}
+
+// needRefresh 判断数据是否需要在过期前提前刷新
+func (c *cache) needRefresh(it *item) bool {
+	if it.notFound {
+		return false
 	}
-	t := time.Now().Unix()
-	cacheLogger.Debug("get key [%s] at %d\n", key, t)
-	c.exMap.lck.Lock()
-	defer c.exMap.lck.Unlock()
-	if exTime, ok := c.exMap.keyExpireMap[key]; ok {
-		delete(c.exMap.timeMap[exTime], key)
+	age := c.clock.Now().Sub(it.loadedAt)
+	if c.refreshAt > 0 && age >= time.Duration(float64(it.ttl)*c.refreshAt) {
+		return true
 	}
-	c.exMap.keyExpireMap[key] = t + int64(expireTime)
-	cacheLogger.Debug("key [%s] will expire at %d\n", key, t+int64(expireTime))
-	keyMap, ok := c.exMap.timeMap[t+int64(expireTime)]
-	if !ok {
-		// 如果 map 不存在，进行初始化
-		keyMap = make(map[string]struct{})
-		c.exMap.timeMap[t+int64(expireTime)] = keyMap
+	if c.refreshBeta > 0 && it.delta > 0 {
+		// XFetch: 加载越慢,越接近过期,提前刷新的概率越大
+		gap := -float64(it.delta) * c.refreshBeta * math.Log(1-rand.Float64())
+		return float64(age)+gap >= float64(it.ttl)
 	}
+	return false
+}
 
-	// 添加元素到内层 map
-	keyMap[key] = struct{}{}
-	cacheLogger.Debug("tring get key [%s] from lru\n", key)
-	if v, ok := c.lru.Get(key, t); ok {
-		return v.(ByteView), ok
+// setJournal 设置所有分片的追加日志记录函数.
+// 记录在持有分片锁时写入,保证日志中同一个key的记录顺序与修改顺序一致
+func (c *cache) setJournal(fn func(aofRecord)) {
+	for _, s := range c.shards {
+		s.lck.Lock()
+		s.journal = fn
+		s.lck.Unlock()
+	}
+}
+
+// setManifestCallback 设置所有分片中分块清单被覆盖,删除,过期或淘汰后的回调函数
+func (c *cache) setManifestCallback(fn func(key string, manifest []byte)) {
+	for _, s := range c.shards {
+		s.lck.Lock()
+		s.onDropManifest = fn
+		s.lck.Unlock()
 	}
-	cacheLogger.Debug("key [%s] miss\n", key)
-	return ByteView{}, false
+}
+
+// get 返回key对应的数据以及剩余存活时间,剩余存活时间为0表示永不过期
+func (c *cache) get(key string) (it *item, ttl time.Duration, ok bool) {
+	return c.shard(key).get(key)
 }
 
 func (c *cache) delete(key string) {
-	c.lck.Lock()
-	defer c.lck.Unlock()
-	if c.lru == nil {
-		return
+	c.shard(key).delete(key)
+}
+
+// deleteIf 在key存在且满足fn时删除key,返回是否删除
+func (c *cache) deleteIf(key string, fn func(it *item) bool) bool {
+	return c.shard(key).deleteIf(key, fn)
+}
+
+// len 返回缓存中数据的数量
+func (c *cache) len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.lck.Lock()
+		n += s.lru.Len()
+		s.lck.Unlock()
 	}
-	c.exMap.lck.Lock()
-	defer c.exMap.lck.Unlock()
-	if exTime, ok := c.exMap.keyExpireMap[key]; ok {
-		delete(c.exMap.timeMap[exTime], key)
-		delete(c.exMap.keyExpireMap, key)
+	return n
+}
+
+// usage 返回所有分片的占用情况之和
+func (c *cache) usage() lru.Usage {
+	var u lru.Usage
+	for _, s := range c.shards {
+		s.lck.Lock()
+		su := s.lru.Usage()
+		s.lck.Unlock()
+		u.HeatBytes += su.HeatBytes
+		u.HeatItems += su.HeatItems
+		u.ColdBytes += su.ColdBytes
+		u.ColdItems += su.ColdItems
 	}
-	c.lru.Delete(key)
+	return u
 }
 
-func (c *cache) multiDelete(keys []string) {
-	cacheLogger.Debug("start to delete keys [%v]\n", keys)
-	c.lck.Lock()
-	defer c.lck.Unlock()
-	if c.lru == nil {
-		return
+// evicted 在数据被lru淘汰或删除时清理过期记录并记录回调,调用者需要持有锁
+func (s *cacheShard) evicted(key string, value lru.Value) {
+	s.exMap.removeExpire(key)
+	it := value.(*item)
+	s.tags.remove(key, it.tags, nil)
+	s.keys.remove(key)
+	if (s.onEvicted != nil || it.manifest) && !it.notFound {
+		s.events = append(s.events, evictEvent{key: key, value: it.view, reason: s.reason, manifest: it.manifest})
+	}
+}
+
+// remove 因为reason删除key,调用者需要持有锁
+func (s *cacheShard) remove(key string, reason EvictReason) bool {
+	s.reason = reason
+	ok := s.lru.Delete(key)
+	s.reason = EvictCapacity
+	s.exMap.removeExpire(key)
+	if ok && reason == EvictExpired {
+		s.logLocked(aofRecord{op: opExpire, key: key})
+	}
+	return ok
+}
+
+// logLocked 在设置了追加日志时写入一条记录,调用者需要持有锁
+func (s *cacheShard) logLocked(rec aofRecord) {
+	if s.journal != nil {
+		s.journal(rec)
 	}
-	c.exMap.lck.Lock()
-	defer c.exMap.lck.Unlock()
+}
+
+// unlock 释放锁,并执行持有锁期间产生的回调
+func (s *cacheShard) unlock() {
+	events := s.events
+	s.events = nil
+	s.lck.Unlock()
+	for _, e := range events {
+		if e.manifest && s.onDropManifest != nil {
+			s.onDropManifest(e.key, e.value.data)
+		}
+		if s.onEvicted != nil {
+			s.onEvicted(e.key, e.value, e.reason)
+		}
+	}
+}
+
+// removeExpired 删除时间轮中已经到期的key,每次最多删除expireBudget个,
+// 剩余的key在下一次检查时删除.返回删除的key数量
+func (s *cacheShard) removeExpired() int {
+	s.lck.Lock()
+	defer s.unlock()
+	now := s.clock.Now()
+	keys := s.exMap.wheel.Advance(now, expireBudget)
+	n := 0
 	for _, key := range keys {
-		if exTime, ok := c.exMap.keyExpireMap[key]; ok {
-			delete(c.exMap.timeMap[exTime], key)
-			delete(c.exMap.keyExpireMap, key)
+		// 取出后key可能被重新写入,需要再次确认是否过期
+		if s.exMap.expired(key, now) {
+			s.remove(key, EvictExpired)
+			n++
+		}
+	}
+	if n > 0 {
+		cacheLogger.Debug("%d keys expired at %v\n", n, now)
+	}
+	return n
+}
+
+func (s *cacheShard) add(key string, it *item, ttl time.Duration) bool {
+	s.lck.Lock()
+	defer s.unlock()
+	return s.addLocked(key, it, ttl)
+}
+
+// addLocked 写入数据并分配新的版本号,调用者需要持有锁
+func (s *cacheShard) addLocked(key string, it *item, ttl time.Duration) bool {
+	now := s.clock.Now()
+	if ttl <= 0 {
+		ttl = expireTime
+	}
+	info := expireInfo{at: now.Add(ttl), ttl: ttl}
+	it.loadedAt, it.ttl, it.version = now, ttl, s.version.Add(1)
+	if s.mode == SlidingExpirationWithMaxAge && s.maxAge > 0 {
+		info.deadline = now.Add(s.maxAge)
+	}
+	v, replaced := s.lru.Peek(key)
+	// 先记录过期时间和标签,如果key加入后立即被淘汰,回调函数会清理过期记录和标签
+	s.exMap.setExpire(key, info)
+	s.tags.add(key, it.tags)
+	ok := s.lru.Add(key, it, now.Unix())
+	old, _ := v.(*item)
+	s.retagLocked(key, old, it, ok)
+	s.indexLocked(key)
+	if ok && replaced && (s.onEvicted != nil || old.manifest) && !old.notFound {
+		s.events = append(s.events, evictEvent{key: key, value: old.view, reason: EvictReplaced, manifest: old.manifest})
+	}
+	return ok
+}
+
+// update 在持有锁的情况下实现原子的读-改-写.fn根据key当前的数据返回新的数据及其存活时间,
+// key不存在,已经过期或者是负缓存时old为nil.fn返回错误时不写入
+func (s *cacheShard) update(key string, fn func(old *item) (*item, time.Duration, error)) (*item, error) {
+	s.lck.Lock()
+	defer s.unlock()
+	return s.updateLocked(key, fn)
+}
+
+// write 与update相同,写入成功后在持有锁时记录追加日志.fn额外返回压缩前的值,日志中保存压缩前的数据
+func (s *cacheShard) write(key string, fn func(old *item) (*item, []byte, time.Duration, error)) (*item, error) {
+	s.lck.Lock()
+	defer s.unlock()
+	var value []byte
+	it, err := s.updateLocked(key, func(old *item) (*item, time.Duration, error) {
+		it, v, ttl, err := fn(old)
+		value = v
+		return it, ttl, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logLocked(aofRecord{op: setOp(it.manifest), key: key, value: value, expireAt: it.loadedAt.Add(it.ttl), ttl: it.ttl, tags: it.tags})
+	return it, nil
+}
+
+// updateLocked 见update,调用者需要持有锁
+func (s *cacheShard) updateLocked(key string, fn func(old *item) (*item, time.Duration, error)) (*item, error) {
+	var old *item
+	if !s.exMap.expired(key, s.clock.Now()) {
+		if v, ok := s.lru.Peek(key); ok && !v.(*item).notFound {
+			old = v.(*item)
+		}
+	}
+	it, ttl, err := fn(old)
+	if err != nil {
+		return nil, err
+	}
+	if !s.addLocked(key, it, ttl) {
+		return nil, fmt.Errorf("key [%s] is too large to cache", key)
+	}
+	return it, nil
+}
+
+// keepTTLLocked 返回重新写入key时保持原来过期时间所需的存活时间,调用者需要持有锁.
+// 滑动过期时写入相当于一次访问,使用key自身的存活时间
+func (s *cacheShard) keepTTLLocked(key string) time.Duration {
+	info, ok := s.exMap.keyExpireMap[key]
+	if !ok {
+		return 0
+	}
+	if s.mode != AbsoluteExpiration {
+		return info.ttl
+	}
+	return info.at.Sub(s.clock.Now())
+}
+
+func (s *cacheShard) get(key string) (it *item, ttl time.Duration, ok bool) {
+	s.lck.Lock()
+	defer s.unlock()
+	now := s.clock.Now()
+	cacheLogger.Debug("get key [%s] at %v\n", key, now)
+	if s.exMap.expired(key, now) {
+		// 惰性删除已经过期但还未被后台清理的key
+		cacheLogger.Debug("key [%s] expired\n", key)
+		s.remove(key, EvictExpired)
+		return nil, 0, false
+	}
+
+	cacheLogger.Debug("tring get key [%s] from lru\n", key)
+	v, ok := s.lru.Get(key, now.Unix())
+	if !ok {
+		cacheLogger.Debug("key [%s] miss\n", key)
+		return nil, 0, false
+	}
+
+	it = v.(*item)
+	if info, ok := s.exMap.keyExpireMap[key]; ok {
+		// 负缓存总是在写入后固定时间过期,保证数据源中新增的key能够被及时加载
+		if s.mode != AbsoluteExpiration && !it.notFound {
+			// 访问时按照key自身的存活时间延长过期时间
+			info.at = now.Add(info.ttl)
+			s.exMap.setExpire(key, info)
+			info = s.exMap.keyExpireMap[key]
 		}
-		c.lru.Delete(key)
+		ttl = info.at.Sub(now)
+		cacheLogger.Debug("key [%s] will expire at %v\n", key, info.at)
 	}
-	cacheLogger.Debug("keys [%v] deleted\n", keys)
+	return it, ttl, true
+}
 
+func (s *cacheShard) delete(key string) {
+	s.lck.Lock()
+	defer s.unlock()
+	s.remove(key, EvictDeleted)
+	// key可能已经被淘汰,但是日志中仍然有之前的写入,因此总是记录删除
+	s.logLocked(aofRecord{op: opDelete, key: key})
+}
+
+func (s *cacheShard) deleteIf(key string, fn func(it *item) bool) bool {
+	s.lck.Lock()
+	defer s.unlock()
+	if v, ok := s.lru.Peek(key); !ok || !fn(v.(*item)) {
+		return false
+	}
+	s.remove(key, EvictDeleted)
+	s.logLocked(aofRecord{op: opDelete, key: key})
+	return true
+}
+
+// confDuration 读取以unit为单位的配置项,未配置时使用默认值
+func confDuration(key string, def int64, unit time.Duration) time.Duration {
+	if v := conf.Conf.GetInt64(key); v > 0 {
+		return time.Duration(v) * unit
+	}
+	return time.Duration(def) * unit
+}
+
+// confInt 读取整数配置项,未配置时使用默认值
+func confInt(key string, def int) int {
+	if v := conf.Conf.GetInt(key); v > 0 {
+		return v
+	}
+	return def
 }
@@ -1,8 +1,23 @@
 package mycache
 
 import (
+	"TDKCache/cache/lru"
+	"TDKCache/cache/timingwheel"
+	"TDKCache/peers"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -13,6 +28,17 @@ var db = map[string]string{
 	"Sam":  "102",
 }
 
+// newTestGroup 创建group,并在测试结束时销毁,使不同的测试可以使用相同的名字
+func newTestGroup(t *testing.T, name string, capacity int64, getter Getter, opts ...Option) *Group {
+	t.Helper()
+	g, err := NewGroup(name, capacity, getter, opts...)
+	if err != nil {
+		t.Fatalf("create group %s failed: %v", name, err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
 func TestGetter(t *testing.T) {
 	var f Getter = GetterFunc(func(key string) ([]byte, error) {
 		return []byte(key), nil
@@ -25,7 +51,7 @@ func TestGetter(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	g := NewGroup("score", 2<<10, GetterFunc(
+	g := newTestGroup(t, "score", 2<<10, GetterFunc(
 		func(key string) ([]byte, error) {
 			fmt.Printf("[SlowDB] search key %s\n", key)
 			if v, ok := db[key]; ok {
@@ -55,7 +81,8 @@ func TestGet(t *testing.T) {
 
 func TestExpire(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	g := NewGroup("score", 2<<10, GetterFunc(
+	clock := timingwheel.NewFakeClock(time.Now())
+	g := newTestGroup(t, "score", 2<<10, GetterFunc(
 		func(key string) ([]byte, error) {
 			fmt.Printf("[SlowDB] search key %s\n", key)
 			if v, ok := db[key]; ok {
@@ -66,7 +93,7 @@ func TestExpire(t *testing.T) {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("key [%s] not exist", key)
-		}))
+		}), WithClock(clock))
 	for k, v := range db {
 		if view, err := g.Get(k); err != nil || view.String() != v {
 			t.Fatalf("get error: %v\nfailed to get value of key [%s]", err, k)
@@ -74,9 +101,1776 @@ func TestExpire(t *testing.T) {
 		if _, err := g.Get(k); err != nil || loadCounts[k] > 1 {
 			t.Fatalf("cache [%s] miss", k)
 		}
-		time.Sleep(time.Second * 3)
+		clock.Advance(expireTime)
 		if _, err := g.Get(k); err != nil || loadCounts[k] < 2 {
 			t.Fatalf("cache [%s] does not expire", k)
 		}
 	}
 }
+
+func TestRemoveExpired(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	c := NewCache(2<<10, nil, WithClock(clock))
+	c.add("k1", ByteView{data: []byte("v1")}, time.Millisecond*100)
+	c.add("k2", ByteView{data: []byte("v2")}, time.Millisecond*300)
+
+	clock.Advance(time.Millisecond * 99)
+	if c.removeExpired(); c.len() != 2 {
+		t.Fatalf("expect no key expired, but got %d keys", c.len())
+	}
+
+	clock.Advance(time.Millisecond)
+	if c.removeExpired(); c.len() != 1 {
+		t.Fatalf("expect k1 expired, but got %d keys", c.len())
+	}
+
+	// 访问k2会延长其过期时间
+	clock.Advance(time.Millisecond * 100)
+	if _, ttl, ok := c.get("k2"); !ok || ttl != time.Millisecond*300 {
+		t.Fatalf("failed to get k2")
+	}
+	clock.Advance(time.Millisecond * 200)
+	if c.removeExpired(); c.len() != 1 {
+		t.Fatalf("expect k2 not expired")
+	}
+	clock.Advance(time.Millisecond * 100)
+	if _, _, ok := c.get("k2"); ok {
+		t.Fatalf("expect k2 expired")
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	g := newTestGroup(t, "ttl", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), time.Second * 5, nil
+			}
+			return nil, 0, fmt.Errorf("key [%s] not exist", key)
+		}))
+
+	if view, ttl, err := g.GetWithTTL("Tom"); err != nil || view.String() != db["Tom"] || ttl != time.Second*5 {
+		t.Fatalf("failed to get key [Tom] with ttl, got %v %v %v", view, ttl, err)
+	}
+
+	if err := g.SetWithTTL("key", []byte("value"), time.Second*2); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if view, ttl, err := g.GetWithTTL("key"); err != nil || view.String() != "value" || ttl != time.Second*2 {
+		t.Fatalf("failed to get key [key] with ttl, got %v %v %v", view, ttl, err)
+	}
+
+	if err := g.SetWithTTL("default", []byte("value"), 0); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if _, ttl, err := g.GetWithTTL("default"); err != nil || ttl != expireTime {
+		t.Fatalf("expect default ttl %v, but got %v", expireTime, ttl)
+	}
+}
+
+func TestGroupPolicy(t *testing.T) {
+	for _, name := range []string{"hc", "lru", "lfu", "arc", "wtinylfu"} {
+		newPolicy, err := lru.PolicyByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := newTestGroup(t, "policy-"+name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				if v, ok := db[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, fmt.Errorf("key [%s] not exist", key)
+			}), WithPolicy(newPolicy))
+
+		for k, v := range db {
+			if view, err := g.Get(k); err != nil || view.String() != v {
+				t.Fatalf("policy %s: failed to get value of key [%s]", name, k)
+			}
+			if _, _, ok := g.mainCache.get(k); !ok {
+				t.Fatalf("policy %s: key [%s] not cached", name, k)
+			}
+		}
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	tests := []struct {
+		capacity int64
+		want     int
+		expect   int
+	}{
+		{2 << 10, 16, 2},
+		{1 << 20, 16, 16},
+		{1 << 20, 10, 8},
+		{100, 16, 1},
+		{1 << 20, 0, 1},
+	}
+	for _, tt := range tests {
+		if n := shardCount(tt.capacity, tt.want); n != tt.expect {
+			t.Fatalf("shardCount(%d, %d) = %d, expect %d", tt.capacity, tt.want, n, tt.expect)
+		}
+	}
+
+	c := NewCache(1<<20, nil, WithShards(16))
+	for i := 0; i < 1000; i++ {
+		c.add(fmt.Sprintf("key%d", i), ByteView{data: []byte("value")}, 0)
+	}
+	for i, s := range c.shards {
+		if s.lru.Len() == 0 {
+			t.Fatalf("shard %d is empty", i)
+		}
+	}
+	if c.len() != 1000 {
+		t.Fatalf("expect 1000 keys, but got %d", c.len())
+	}
+}
+
+// benchmarkCacheGet 在读多写少(9:1)的负载下测试缓存的吞吐量,
+// 使用 go test -bench CacheGet -cpu 1,2,4,8 观察吞吐量随GOMAXPROCS的变化
+func benchmarkCacheGet(b *testing.B, shards int) {
+	const keys = 1 << 12
+	c := NewCache(1<<24, nil, WithShards(shards))
+	names := make([]string, keys)
+	value := ByteView{data: []byte("value")}
+	for i := range names {
+		names[i] = fmt.Sprintf("key%d", i)
+		c.add(names[i], value, 0)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := names[i&(keys-1)]
+			if i%10 == 0 {
+				c.add(key, value, 0)
+			} else {
+				c.get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheGetSingleShard(b *testing.B) {
+	benchmarkCacheGet(b, 1)
+}
+
+func BenchmarkCacheGetSharded(b *testing.B) {
+	benchmarkCacheGet(b, defaultShards)
+}
+
+func TestExpirationMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    Option
+		expect []bool // 每隔100ms访问一次key时是否命中
+	}{
+		{"sliding", WithExpiration(SlidingExpiration, 0), []bool{true, true, true, true, true}},
+		{"absolute", WithExpiration(AbsoluteExpiration, 0), []bool{true, false, false, false, false}},
+		{"max-age", WithExpiration(SlidingExpirationWithMaxAge, time.Millisecond*350), []bool{true, true, true, false, false}},
+	}
+
+	for _, tt := range tests {
+		clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+		c := NewCache(2<<10, nil, WithClock(clock), tt.opt)
+		c.add("key", ByteView{data: []byte("value")}, time.Millisecond*150)
+		for i, expect := range tt.expect {
+			clock.Advance(time.Millisecond * 100)
+			if _, _, ok := c.get("key"); ok != expect {
+				t.Fatalf("%s: expect hit=%v at %dms, but got %v", tt.name, expect, (i+1)*100, ok)
+			}
+		}
+	}
+}
+
+func TestRemainingTTL(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	c := NewCache(2<<10, nil, WithClock(clock), WithExpiration(SlidingExpirationWithMaxAge, time.Second))
+	c.add("key", ByteView{data: []byte("value")}, time.Millisecond*600)
+
+	clock.Advance(time.Millisecond * 100)
+	if _, ttl, _ := c.get("key"); ttl != time.Millisecond*600 {
+		t.Fatalf("expect ttl 600ms, but got %v", ttl)
+	}
+	// 受最长存活时间限制,剩余时间不超过写入后的1s
+	clock.Advance(time.Millisecond * 500)
+	if _, ttl, _ := c.get("key"); ttl != time.Millisecond*400 {
+		t.Fatalf("expect ttl 400ms, but got %v", ttl)
+	}
+}
+
+func TestEvictionCallback(t *testing.T) {
+	events := make(map[string]EvictReason)
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	newPolicy, _ := lru.PolicyByName("lru")
+	var g *Group
+	g = newTestGroup(t, "callback", 64, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key [%s] not exist", key)
+		}),
+		WithClock(clock),
+		WithPolicy(newPolicy),
+		WithEvictionCallback(func(key string, value ByteView, reason EvictReason) {
+			// 回调函数中可以安全地访问缓存
+			g.mainCache.get(key)
+			if _, ok := events[key]; !ok {
+				events[key] = reason
+			}
+		}))
+
+	g.SetWithTTL("replaced", []byte("v1"), 0)
+	g.SetWithTTL("replaced", []byte("v2"), 0)
+	g.SetWithTTL("deleted", []byte("v"), 0)
+	g.Delete("deleted")
+	g.SetWithTTL("expired", []byte("v"), time.Second)
+	clock.Advance(time.Second)
+	g.mainCache.removeExpired()
+	// 容量为64字节,写入更多数据会淘汰最久未使用的key
+	g.SetWithTTL("capacity", []byte("v"), 0)
+	for i := 0; i < 10; i++ {
+		g.SetWithTTL(fmt.Sprintf("key%d", i), []byte("value"), 0)
+	}
+
+	expect := map[string]EvictReason{
+		"replaced": EvictReplaced,
+		"deleted":  EvictDeleted,
+		"expired":  EvictExpired,
+		"capacity": EvictCapacity,
+	}
+	for key, reason := range expect {
+		if r, ok := events[key]; !ok || r != reason {
+			t.Fatalf("expect key [%s] evicted for %v, but got %v", key, reason, r)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	release := make(chan struct{})
+	g := newTestGroup(t, "stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				<-release
+			}
+			if v, ok := db[key]; ok || key == "slow" {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("key [%s] not exist", key)
+		}), WithClock(clock))
+
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("unknown")
+
+	// 并发加载同一个key时只有一个请求会调用Getter
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get("slow")
+		}()
+	}
+	for g.Stats().Misses < 7 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+	close(release)
+	wg.Wait()
+
+	stats := g.Stats()
+	expect := Stats{
+		Gets:          8,
+		Hits:          1,
+		Misses:        7,
+		LocalLoads:    2,
+		LocalLoadErrs: 1,
+		DedupedLoads:  4,
+	}
+	if stats.Gets != expect.Gets || stats.Hits != expect.Hits || stats.Misses != expect.Misses ||
+		stats.LocalLoads != expect.LocalLoads || stats.LocalLoadErrs != expect.LocalLoadErrs ||
+		stats.DedupedLoads != expect.DedupedLoads {
+		t.Fatalf("expect stats %+v, but got %+v", expect, stats)
+	}
+	if stats.HeatItems+stats.ColdItems != 2 || stats.HeatBytes+stats.ColdBytes == 0 {
+		t.Fatalf("expect 2 items cached, but got %+v", stats)
+	}
+
+	clock.Advance(expireTime)
+	g.mainCache.removeExpired()
+	if stats = g.Stats(); stats.Expirations != 2 || stats.HeatItems+stats.ColdItems != 0 {
+		t.Fatalf("expect 2 items expired, but got %+v", stats)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	loadCounts := make(map[string]int)
+	g := newTestGroup(t, "negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, &NotFoundError{Key: key}
+		}), WithClock(clock), WithNegativeTTL(time.Second))
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("unknown"); !IsNotFound(err) {
+			t.Fatalf("expect not found error, but got %v", err)
+		}
+		// 负缓存不会因为访问而延长存活时间
+		clock.Advance(time.Millisecond * 300)
+	}
+	if loadCounts["unknown"] != 1 {
+		t.Fatalf("expect getter called once, but got %d", loadCounts["unknown"])
+	}
+
+	clock.Advance(time.Millisecond * 100)
+	db["unknown"] = "100"
+	defer delete(db, "unknown")
+	if v, err := g.Get("unknown"); err != nil || v.String() != "100" {
+		t.Fatalf("expect 100 after negative entry expired, but got %v %v", v, err)
+	}
+	if stats := g.Stats(); stats.NegativeHits != 2 || stats.LocalLoadErrs != 0 {
+		t.Fatalf("expect 2 negative hits and no load errors, but got %+v", stats)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	release := make(chan struct{})
+	var loads atomic.Int64
+	g := newTestGroup(t, "refresh", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			if n := loads.Add(1); n > 1 {
+				<-release
+			}
+			return []byte(fmt.Sprintf("v%d", loads.Load())), time.Second, nil
+		}), WithClock(clock), WithRefreshAhead(0.5))
+
+	if v, _ := g.Get("key"); v.String() != "v1" {
+		t.Fatalf("expect v1, but got %s", v)
+	}
+	clock.Advance(time.Millisecond * 400)
+	g.Get("key")
+	if stats := g.Stats(); stats.Refreshes != 0 {
+		t.Fatalf("expect no refresh before half of ttl, but got %d", stats.Refreshes)
+	}
+
+	// 超过一半的存活时间后在后台刷新,刷新完成前返回旧值
+	clock.Advance(time.Millisecond * 200)
+	for i := 0; i < 3; i++ {
+		if v, _ := g.Get("key"); v.String() != "v1" {
+			t.Fatalf("expect stale v1 during refresh, but got %s", v)
+		}
+	}
+	close(release)
+	for {
+		if v, _ := g.Get("key"); v.String() == "v2" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := g.Stats(); stats.Refreshes != 1 || loads.Load() != 2 {
+		t.Fatalf("expect refresh once, but got %d refreshes and %d loads", stats.Refreshes, loads.Load())
+	}
+}
+
+func TestRefreshKeepsSetValue(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	g := newTestGroup(t, "refresh-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, &NotFoundError{Key: key}
+		}), WithClock(clock), WithRefreshAhead(0.5))
+
+	if err := g.SetWithTTL("key", []byte("written"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Millisecond * 600)
+	if v, _ := g.Get("key"); v.String() != "written" {
+		t.Fatalf("expect written, but got %s", v)
+	}
+	for {
+		if _, ok := g.refreshing.Load("key"); !ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 数据源中不存在的key不能通过刷新替换写入的值
+	if v, err := g.Get("key"); err != nil || v.String() != "written" {
+		t.Fatalf("expect written after refresh, but got %s, %v", v, err)
+	}
+}
+
+func TestEarlyRefresh(t *testing.T) {
+	c := NewCache(2<<10, nil, WithEarlyRefresh(1))
+	it := &item{view: ByteView{data: []byte("v")}, delta: time.Millisecond * 100}
+	c.addItem("key", it, time.Hour)
+	if c.needRefresh(it) {
+		t.Fatalf("expect no early refresh far from expiration")
+	}
+	it.loadedAt = it.loadedAt.Add(-time.Hour)
+	if !c.needRefresh(it) {
+		t.Fatalf("expect early refresh after expiration")
+	}
+}
+
+type testPeer struct {
+	calls atomic.Int64
+	mu    sync.Mutex
+	sets  map[string]string
+}
+
+func (p *testPeer) PickPeer(key string) (peers.PeerGetter, bool) {
+	return p, true
+}
+
+func (p *testPeer) Get(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	p.calls.Add(1)
+	return []byte("remote-" + key), 0, nil
+}
+
+func (p *testPeer) AllPeers() []peers.PeerGetter {
+	return []peers.PeerGetter{p}
+}
+
+func (p *testPeer) Delete(ctx context.Context, group string, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sets, key)
+	return nil
+}
+
+func (p *testPeer) BatchGet(ctx context.Context, group string, keys []string) ([]peers.KeyResult, error) {
+	p.calls.Add(1)
+	results := make([]peers.KeyResult, len(keys))
+	for i, key := range keys {
+		if key == "missing" {
+			results[i] = peers.KeyResult{Key: key, Err: &NotFoundError{Key: key}}
+			continue
+		}
+		results[i] = peers.KeyResult{Key: key, Value: []byte("remote-" + key)}
+	}
+	return results, nil
+}
+
+func (p *testPeer) Scan(ctx context.Context, group string, prefix string, cursor string, limit int) ([]peers.KeyInfo, string, error) {
+	return nil, "", nil
+}
+
+func (p *testPeer) GetVersion(ctx context.Context, group string, key string) (peers.KeyResult, error) {
+	p.calls.Add(1)
+	return peers.KeyResult{Key: key, Value: []byte("remote-" + key), Version: 1}, nil
+}
+
+func (p *testPeer) CompareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return version + 1, p.Set(ctx, group, key, value, ttl)
+}
+
+func (p *testPeer) SetWithTags(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string) error {
+	return p.Set(ctx, group, key, value, ttl)
+}
+
+func (p *testPeer) SetManifest(ctx context.Context, group string, key string, manifest []byte, ttl time.Duration, tags []string) error {
+	return p.Set(ctx, group, key, manifest, ttl)
+}
+
+func (p *testPeer) CompareAndSwapManifest(ctx context.Context, group string, key string, version uint64, manifest []byte, ttl time.Duration) (uint64, error) {
+	return p.CompareAndSwap(ctx, group, key, version, manifest, ttl)
+}
+
+func (p *testPeer) InvalidateTag(ctx context.Context, group string, tag string) (int, error) {
+	return 0, nil
+}
+
+func (p *testPeer) DeletePattern(ctx context.Context, group string, pattern string) (int, error) {
+	return 0, nil
+}
+
+func (p *testPeer) Incr(ctx context.Context, group string, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return initial + delta, nil
+}
+
+func (p *testPeer) Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sets == nil {
+		p.sets = make(map[string]string)
+	}
+	p.sets[key] = string(value)
+	return nil
+}
+
+func TestHotCache(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	peer := &testPeer{}
+	g := newTestGroup(t, "hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key [%s] should be loaded from peer", key)
+			return nil, nil
+		}), WithClock(clock), WithHotCache(1<<10, time.Second), WithHotAdmission(FrequencyAdmission(2)))
+	g.RegisterPeers(peer)
+
+	for i := 0; i < 5; i++ {
+		if v, err := g.Get("key"); err != nil || v.String() != "remote-key" {
+			t.Fatalf("expect remote-key, but got %v %v", v, err)
+		}
+	}
+	// 第二次远程加载后放入热点缓存
+	stats := g.Stats()
+	if peer.calls.Load() != 2 || stats.HotHits != 3 || stats.HotItems != 1 {
+		t.Fatalf("expect 2 peer calls and 3 hot hits, but got %d calls and %+v", peer.calls.Load(), stats)
+	}
+
+	// 热点缓存中的数据不随访问延长存活时间
+	clock.Advance(time.Millisecond * 600)
+	g.Get("key")
+	clock.Advance(time.Millisecond * 600)
+	g.Get("key")
+	if peer.calls.Load() != 3 {
+		t.Fatalf("expect hot entry expired, but got %d peer calls", peer.calls.Load())
+	}
+
+	g.Delete("key")
+	if stats := g.Stats(); stats.HotItems != 0 {
+		t.Fatalf("expect hot entry deleted, but got %+v", stats)
+	}
+}
+
+func TestSetToPeer(t *testing.T) {
+	peer := &testPeer{}
+	g := newTestGroup(t, "set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, &NotFoundError{Key: key}
+		}), WithHotCache(1<<10, 0), WithHotAdmission(SampleAdmission(1)))
+	g.RegisterPeers(peer)
+
+	g.Get("key")
+	if stats := g.Stats(); stats.HotItems != 1 {
+		t.Fatalf("expect key in hot cache, but got %+v", stats)
+	}
+	if err := g.Set("key", []byte("value")); err != nil {
+		t.Fatalf("set key failed: %v", err)
+	}
+	// 写入负责该key的节点,本地不保存,同时删除过时的热点副本
+	if peer.sets["key"] != "value" {
+		t.Fatalf("expect key set to peer, but got %v", peer.sets)
+	}
+	if stats := g.Stats(); stats.HotItems != 0 || stats.HeatItems+stats.ColdItems != 0 {
+		t.Fatalf("expect nothing cached locally, but got %+v", stats)
+	}
+
+	if err := g.SetLocally("local", []byte("value"), 0); err != nil {
+		t.Fatalf("set key locally failed: %v", err)
+	}
+	if len(peer.sets) != 1 {
+		t.Fatalf("expect local set not forwarded, but got %v", peer.sets)
+	}
+
+	// 淘汰策略拒绝写入时返回错误
+	newLRU, _ := lru.PolicyByName("lru")
+	small := newTestGroup(t, "set-small", 64, g.getter, WithPolicy(newLRU), WithShards(1), WithChunkSize(1<<10))
+	if err := small.Set("big", make([]byte, 128)); err == nil {
+		t.Fatalf("expect error when value is larger than capacity")
+	}
+	if _, err := small.Get("big"); !IsNotFound(err) {
+		t.Fatalf("expect rejected value not cached, but got %v", err)
+	}
+}
+
+func TestDeleteFromPeer(t *testing.T) {
+	peer := &testPeer{}
+	g := newTestGroup(t, "delete", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, &NotFoundError{Key: key}
+		}), WithHotCache(1<<10, 0), WithHotAdmission(SampleAdmission(1)))
+	g.RegisterPeers(peer)
+
+	g.Set("key", []byte("value"))
+	g.SetLocally("key", []byte("value"), 0)
+	g.Get("other")
+	if err := g.Delete("key"); err != nil {
+		t.Fatalf("delete key failed: %v", err)
+	}
+	if _, ok := peer.sets["key"]; ok {
+		t.Fatalf("expect key deleted from peer")
+	}
+	if stats := g.Stats(); stats.HeatItems+stats.ColdItems != 0 || stats.HotItems != 1 {
+		t.Fatalf("expect local copy deleted, but got %+v", stats)
+	}
+
+	if err := g.DeleteEverywhere("other"); err != nil {
+		t.Fatalf("delete key everywhere failed: %v", err)
+	}
+	if stats := g.Stats(); stats.HotItems != 0 {
+		t.Fatalf("expect hot copy deleted, but got %+v", stats)
+	}
+}
+
+// splitPeer 将以remote开头的key分配给远程节点
+type splitPeer struct {
+	testPeer
+}
+
+func (p *splitPeer) PickPeer(key string) (peers.PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") || key == "missing" {
+		return p, true
+	}
+	return nil, false
+}
+
+func TestGetMulti(t *testing.T) {
+	peer := &splitPeer{}
+	g := newTestGroup(t, "multi", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, &NotFoundError{Key: key}
+		}))
+	g.RegisterPeers(peer)
+	g.Get("Tom")
+
+	keys := []string{"Tom", "remote1", "Jack", "remote2", "unknown", "missing", ""}
+	results := g.GetMulti(keys)
+	expect := []string{"100", "remote-remote1", "101", "remote-remote2"}
+	for i, v := range expect {
+		if results[i].Key != keys[i] || results[i].Err != nil || results[i].Value.String() != v {
+			t.Fatalf("expect %s = %s, but got %+v", keys[i], v, results[i])
+		}
+	}
+	if !IsNotFound(results[4].Err) || !IsNotFound(results[5].Err) || results[6].Err == nil {
+		t.Fatalf("expect errors for missing keys, but got %+v", results[4:])
+	}
+	// 远程节点负责的key只发送一次批量请求
+	if peer.calls.Load() != 1 {
+		t.Fatalf("expect 1 batch request, but got %d", peer.calls.Load())
+	}
+	if stats := g.Stats(); stats.Hits != 1 || stats.PeerLoads != 3 || stats.LocalLoads != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	var loads atomic.Int64
+	g := newTestGroup(t, "context", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			loads.Add(1)
+			if key == "slow" {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return nil, 0, ctx.Err()
+				}
+			}
+			return []byte("value"), 0, nil
+		}))
+
+	// ctx结束时Getter收到取消
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, but got %v", err)
+	}
+
+	// 等待中的调用方在自己的ctx结束时返回,不影响正在进行的加载
+	done := make(chan error)
+	go func() {
+		_, err := g.GetContext(context.Background(), "slow")
+		done <- err
+	}()
+	for loads.Load() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect waiting caller to give up, but got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expect leader to finish loading, but got %v", err)
+	}
+	if v, err := g.Get("slow"); err != nil || v.String() != "value" || loads.Load() != 2 {
+		t.Fatalf("expect cached value, but got %v %v after %d loads", v, err, loads.Load())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "snapshot", 2<<10, getter, WithClock(clock), WithShards(1))
+	g.SetLocally("short", []byte("1"), time.Second)
+	g.SetLocally("long", []byte("2"), time.Minute)
+	g.SetLocally("hot", []byte("3"), time.Minute)
+	g.Get("hot")
+	g.Get("missing")
+
+	var buf bytes.Buffer
+	if err := g.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("save snapshot failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// 恢复时跳过保存后已经过期的数据,保留剩余存活时间和所在区域
+	clock.Advance(time.Second * 2)
+	restored := newTestGroup(t, "restored", 2<<10, getter, WithClock(clock), WithShards(1))
+	n, err := restored.LoadSnapshot(bytes.NewReader(data))
+	if err != nil || n != 2 {
+		t.Fatalf("expect 2 keys restored, but got %d %v", n, err)
+	}
+	if stats := restored.Stats(); stats.HeatItems != 1 {
+		t.Fatalf("expect hot key restored to heat region, but got %+v", stats)
+	}
+	if _, err := restored.Get("short"); !IsNotFound(err) {
+		t.Fatalf("expect expired key skipped, but got %v", err)
+	}
+	if v, ttl, err := restored.GetWithTTL("long"); err != nil || v.String() != "2" || ttl != time.Minute {
+		t.Fatalf("expect long=2 with sliding ttl, but got %v %v %v", v, ttl, err)
+	}
+
+	// 校验失败时不恢复任何数据
+	for i, corrupt := range [][]byte{data[:len(data)-3], append([]byte{}, data...)} {
+		corrupt[len(corrupt)/2] ^= 0xff
+		empty := newTestGroup(t, fmt.Sprintf("corrupt-%d", i), 2<<10, getter, WithClock(clock))
+		if _, err := empty.LoadSnapshot(bytes.NewReader(corrupt)); !errors.Is(err, ErrSnapshotCorrupted) {
+			t.Fatalf("expect corrupted snapshot, but got %v", err)
+		}
+		if stats := empty.Stats(); stats.HeatItems+stats.ColdItems != 0 {
+			t.Fatalf("expect nothing restored, but got %+v", stats)
+		}
+	}
+}
+
+func TestSnapshotFiles(t *testing.T) {
+	dir := t.TempDir()
+	g := newTestGroup(t, "snapshot/files", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, &NotFoundError{Key: key}
+		}))
+	g.SetLocally("key", []byte("value"), 0)
+	if err := SaveSnapshots(dir); err != nil {
+		t.Fatalf("save snapshots failed: %v", err)
+	}
+	g.DeleteLocally("key")
+	if err := LoadSnapshots(dir); err != nil {
+		t.Fatalf("load snapshots failed: %v", err)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "value" {
+		t.Fatalf("expect key restored, but got %v %v", v, err)
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	dir := t.TempDir()
+	clock := timingwheel.NewFakeClock(time.Now())
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "aof", 2<<10, getter, WithClock(clock), WithAppendLog(dir, FsyncAlways))
+	g.SetLocally("k1", []byte("v1"), time.Minute)
+	g.SetLocally("k2", []byte("v2"), time.Minute)
+	g.SetLocally("k1", []byte("v3"), time.Minute)
+	g.SetLocally("short", []byte("v"), time.Second)
+	g.DeleteLocally("k2")
+
+	// 模拟崩溃时写入了不完整的记录
+	path := aofPath(dir, "aof")
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.Write([]byte{0, 0, 0, 9, opSet})
+	f.Close()
+
+	clock.Advance(time.Second * 2)
+	check := func(g *Group) {
+		if v, err := g.Get("k1"); err != nil || v.String() != "v3" {
+			t.Fatalf("expect k1=v3, but got %v %v", v, err)
+		}
+		for _, key := range []string{"k2", "short"} {
+			if _, err := g.Get(key); !IsNotFound(err) {
+				t.Fatalf("expect %s not restored, but got %v", key, err)
+			}
+		}
+	}
+	g.Close()
+	replayed := newTestGroup(t, "aof", 2<<10, getter, WithClock(clock), WithAppendLog(dir, FsyncAlways))
+	check(replayed)
+
+	// 压缩后只保留当前的数据,并且可以继续追加
+	before, _ := os.Stat(path)
+	if err := replayed.CompactLog(); err != nil {
+		t.Fatalf("compact append log failed: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Fatalf("expect log compacted, but size %d -> %d", before.Size(), after.Size())
+	}
+	replayed.SetLocally("k4", []byte("v4"), time.Minute)
+
+	replayed.Close()
+	compacted := newTestGroup(t, "aof", 2<<10, getter, WithClock(clock), WithAppendLog(dir, FsyncNever))
+	check(compacted)
+	if v, err := compacted.Get("k4"); err != nil || v.String() != "v4" {
+		t.Fatalf("expect k4=v4 appended after compaction, but got %v %v", v, err)
+	}
+}
+
+func TestAppendLogCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "aof/corrupted", 2<<10, getter, WithAppendLog(dir, FsyncAlways))
+	g.SetLocally("k1", []byte("v1"), time.Minute)
+	g.SetLocally("k2", []byte("v2"), time.Minute)
+	g.Close()
+
+	// 第一条记录损坏,之后的记录不能被丢弃
+	path := aofPath(dir, "aof/corrupted")
+	data, _ := os.ReadFile(path)
+	data[len(aofMagic)+2+4+2] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	if _, err := NewGroup("aof/corrupted", 2<<10, getter, WithAppendLog(dir, FsyncAlways)); !errors.Is(err, ErrAppendLogCorrupted) {
+		t.Fatalf("expect ErrAppendLogCorrupted, but got %v", err)
+	}
+}
+
+func TestAppendLogCompactConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "aof/concurrent", 2<<10, getter, WithAppendLog(dir, FsyncNever))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				g.Incr("counter", 1)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := g.CompactLog(); err != nil {
+			t.Fatalf("compact append log failed: %v", err)
+		}
+	}
+	wg.Wait()
+	g.Close()
+
+	// 压缩期间的写入不能丢失,也不能与压缩的数据乱序
+	replayed := newTestGroup(t, "aof/concurrent", 2<<10, getter, WithAppendLog(dir, FsyncNever))
+	if v, err := replayed.Get("counter"); err != nil || v.String() != "400" {
+		t.Fatalf("expect counter=400, but got %v %v", v, err)
+	}
+}
+
+func TestSnapshotWithAppendLog(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "aof/snapshot", 2<<10, getter, WithAppendLog(dir, FsyncAlways))
+	g.SetLocally("k1", []byte("v1"), time.Minute)
+	g.SetLocally("k2", []byte("v2"), time.Minute)
+	if err := SaveSnapshots(dir); err != nil {
+		t.Fatalf("save snapshots failed: %v", err)
+	}
+	g.SetLocally("k1", []byte("v3"), time.Minute)
+	g.DeleteLocally("k2")
+	g.Close()
+
+	// 追加日志中的数据比快照新,不能被快照覆盖
+	replayed := newTestGroup(t, "aof/snapshot", 2<<10, getter, WithAppendLog(dir, FsyncAlways))
+	if err := LoadSnapshots(dir); err != nil {
+		t.Fatalf("load snapshots failed: %v", err)
+	}
+	if v, err := replayed.Get("k1"); err != nil || v.String() != "v3" {
+		t.Fatalf("expect k1=v3, but got %v %v", v, err)
+	}
+	if _, err := replayed.Get("k2"); !IsNotFound(err) {
+		t.Fatalf("expect deleted k2 not restored, but got %v", err)
+	}
+}
+
+// groupPeer 将请求转发给另一个Group,模拟远程节点
+type groupPeer struct {
+	g    *Group
+	owns func(key string) bool
+}
+
+func (p *groupPeer) PickPeer(key string) (peers.PeerGetter, bool) {
+	return p, p.owns(key)
+}
+
+func (p *groupPeer) AllPeers() []peers.PeerGetter {
+	return []peers.PeerGetter{p}
+}
+
+func (p *groupPeer) Get(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	v, ttl, err := p.g.GetWithTTLContext(ctx, key)
+	return v.ByteSlice(), ttl, err
+}
+
+func (p *groupPeer) Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	return p.g.SetLocally(key, value, ttl)
+}
+
+func (p *groupPeer) Delete(ctx context.Context, group string, key string) error {
+	return p.g.DeleteLocally(key)
+}
+
+func (p *groupPeer) BatchGet(ctx context.Context, group string, keys []string) ([]peers.KeyResult, error) {
+	results := make([]peers.KeyResult, len(keys))
+	for i, res := range p.g.GetMultiContext(ctx, keys) {
+		results[i] = peers.KeyResult{Key: res.Key, Value: res.Value.ByteSlice(), TTL: res.TTL, Err: res.Err}
+	}
+	return results, nil
+}
+
+func (p *groupPeer) Scan(ctx context.Context, group string, prefix string, cursor string, limit int) ([]peers.KeyInfo, string, error) {
+	keys, next, err := p.g.Scan(prefix, cursor, limit)
+	infos := make([]peers.KeyInfo, len(keys))
+	for i, k := range keys {
+		infos[i] = peers.KeyInfo{Key: k.Key, Size: k.Size, Hot: k.Hot, TTL: k.TTL}
+	}
+	return infos, next, err
+}
+
+func (p *groupPeer) GetVersion(ctx context.Context, group string, key string) (peers.KeyResult, error) {
+	res := p.g.GetVersioned(ctx, key)
+	return peers.KeyResult{Key: key, Value: res.Value.ByteSlice(), TTL: res.TTL, Version: res.Version}, res.Err
+}
+
+func (p *groupPeer) CompareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return p.g.CompareAndSwapLocally(key, version, value, ttl)
+}
+
+func (p *groupPeer) SetWithTags(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string) error {
+	return p.g.SetLocallyWithTags(key, value, ttl, tags)
+}
+
+func (p *groupPeer) SetManifest(ctx context.Context, group string, key string, manifest []byte, ttl time.Duration, tags []string) error {
+	return p.g.SetManifestLocally(key, manifest, ttl, tags)
+}
+
+func (p *groupPeer) CompareAndSwapManifest(ctx context.Context, group string, key string, version uint64, manifest []byte, ttl time.Duration) (uint64, error) {
+	return p.g.CompareAndSwapManifestLocally(key, version, manifest, ttl)
+}
+
+func (p *groupPeer) InvalidateTag(ctx context.Context, group string, tag string) (int, error) {
+	return p.g.InvalidateTagLocally(tag)
+}
+
+func (p *groupPeer) DeletePattern(ctx context.Context, group string, pattern string) (int, error) {
+	return p.g.DeletePatternLocally(pattern)
+}
+
+func (p *groupPeer) Incr(ctx context.Context, group string, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return p.g.IncrLocally(key, delta, initial, ttl)
+}
+
+func TestChunkedValue(t *testing.T) {
+	var chunkLoads atomic.Int64
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if isChunkKey(key) {
+			chunkLoads.Add(1)
+		}
+		if key == "big" {
+			return bytes.Repeat([]byte("b"), 100), nil
+		}
+		return nil, &NotFoundError{Key: key}
+	})
+	remote := newTestGroup(t, "chunk-remote", 2<<10, getter, WithChunkSize(16))
+	g := newTestGroup(t, "chunk", 2<<10, getter, WithChunkSize(16))
+	// 奇数编号的分块保存在远程节点
+	g.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool {
+		return isChunkKey(key) && (key[len(key)-1]-'0')%2 == 1
+	}})
+
+	value := []byte(strings.Repeat("0123456789", 10))
+	if err := g.Set("large", value); err != nil {
+		t.Fatalf("set large value failed: %v", err)
+	}
+	if it, _, ok := g.mainCache.get("large"); !ok {
+		t.Fatalf("expect manifest of large value cached")
+	} else if m, err := decodeManifest(it.view.data); !it.manifest || err != nil || m.count != 7 || m.size != 100 {
+		t.Fatalf("expect manifest of 7 chunks, but got %+v %v", m, err)
+	}
+	if g.mainCache.len() != 1+4 || remote.mainCache.len() != 3 {
+		t.Fatalf("expect chunks split between nodes, but got %d local and %d remote",
+			g.mainCache.len(), remote.mainCache.len())
+	}
+	if v, err := g.Get("large"); err != nil || !bytes.Equal(v.ByteSlice(), value) {
+		t.Fatalf("expect large value reassembled, but got %v %v", v, err)
+	}
+	if res := g.GetMulti([]string{"large"}); res[0].Err != nil || !bytes.Equal(res[0].Value.ByteSlice(), value) {
+		t.Fatalf("expect large value reassembled by GetMulti, but got %+v", res[0])
+	}
+
+	// 通过Getter加载的大对象同样切分保存
+	if v, err := g.Get("big"); err != nil || v.Len() != 100 {
+		t.Fatalf("expect big value loaded, but got %v %v", v, err)
+	}
+	if it, _, _ := g.mainCache.get("big"); it == nil || it.view.Len() != manifestSize {
+		t.Fatalf("expect manifest of big value cached")
+	}
+	if v, err := g.Get("big"); err != nil || v.Len() != 100 {
+		t.Fatalf("expect big value reassembled, but got %v %v", v, err)
+	}
+
+	// 与清单格式相同的普通值原样返回,不会按照其中的分块数量分配内存
+	forged := chunkManifest{id: 1, count: 1 << 30, size: 1 << 40}.encode()
+	if err := g.SetLocally("forged", forged, 0); err != nil {
+		t.Fatalf("set forged value failed: %v", err)
+	}
+	if v, err := g.Get("forged"); err != nil || !bytes.Equal(v.ByteSlice(), forged) {
+		t.Fatalf("expect forged manifest returned as value, but got %v %v", v, err)
+	}
+	if err := g.SetManifestLocally("forged", forged, 0, nil); !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("expect ErrInvalidManifest, but got %v", err)
+	}
+
+	// 调用方不能直接写入或删除分块
+	reserved := chunkKeyPrefix + "large"
+	_, casErr := g.CompareAndSwap(reserved, 0, []byte("x"))
+	_, incrErr := g.Incr(reserved, 1)
+	for op, err := range map[string]error{
+		"set":    g.Set(reserved, []byte("x")),
+		"cas":    casErr,
+		"incr":   incrErr,
+		"delete": g.Delete(reserved),
+	} {
+		if !errors.Is(err, ErrReservedKey) {
+			t.Fatalf("expect ErrReservedKey from %s, but got %v", op, err)
+		}
+	}
+
+	// 清单记录写入时的分块大小,负责key的节点使用不同的分块大小时仍然可以组装
+	owner := newTestGroup(t, "chunk-owner", 4<<10, getter, WithChunkSize(64))
+	writer := newTestGroup(t, "chunk-writer", 2<<10, getter, WithChunkSize(16))
+	owner.RegisterPeers(&groupPeer{g: writer, owns: isChunkKey})
+	writer.RegisterPeers(&groupPeer{g: owner, owns: func(key string) bool { return !isChunkKey(key) }})
+	if err := writer.Set("large", value); err != nil {
+		t.Fatalf("set large value to owner failed: %v", err)
+	}
+	if v, err := writer.Get("large"); err != nil || !bytes.Equal(v.ByteSlice(), value) {
+		t.Fatalf("expect large value assembled by owner, but got %v %v", v, err)
+	}
+
+	// 快照保存清单的标记
+	var buf bytes.Buffer
+	if err := g.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("save snapshot failed: %v", err)
+	}
+	restored := newTestGroup(t, "chunk-restored", 2<<10, getter, WithChunkSize(16))
+	if _, err := restored.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("load snapshot failed: %v", err)
+	}
+	for key, manifest := range map[string]bool{"large": true, "big": true, "forged": false} {
+		if it, _, ok := restored.mainCache.get(key); !ok || it.manifest != manifest {
+			t.Fatalf("expect manifest flag of key [%s] restored as %v", key, manifest)
+		}
+	}
+
+	// 追加日志同样保存清单的标记,压缩后仍然保留
+	dir := t.TempDir()
+	logged := newTestGroup(t, "chunk-aof", 2<<10, getter, WithChunkSize(16), WithAppendLog(dir, FsyncAlways))
+	logged.Set("large", value)
+	logged.SetLocally("forged", forged, 0)
+	for i := 0; i < 2; i++ {
+		logged.Close()
+		logged = newTestGroup(t, "chunk-aof", 2<<10, getter, WithChunkSize(16), WithAppendLog(dir, FsyncAlways))
+		if v, err := logged.Get("large"); err != nil || !bytes.Equal(v.ByteSlice(), value) {
+			t.Fatalf("expect large value replayed, but got %v %v", v, err)
+		}
+		if v, err := logged.Get("forged"); err != nil || !bytes.Equal(v.ByteSlice(), forged) {
+			t.Fatalf("expect forged value replayed as value, but got %v %v", v, err)
+		}
+		if err := logged.CompactLog(); err != nil {
+			t.Fatalf("compact append log failed: %v", err)
+		}
+	}
+
+	// 分块缺失时读取失败,并丢弃清单
+	it, _, _ := g.mainCache.get("large")
+	m, _ := decodeManifest(it.view.data)
+	remote.DeleteLocally(chunkKey("large", m.id, 3))
+	if _, err := g.Get("large"); !errors.Is(err, ErrChunkMissing) {
+		t.Fatalf("expect ErrChunkMissing, but got %v", err)
+	}
+	if _, err := g.Get("large"); !IsNotFound(err) {
+		t.Fatalf("expect manifest dropped after missing chunk, but got %v", err)
+	}
+	if n := chunkLoads.Load(); n != 0 {
+		t.Fatalf("expect getter never called for chunk keys, but got %d calls", n)
+	}
+}
+
+// chunkKeys 返回缓存中分块的数量
+func chunkKeys(caches ...*cache) int {
+	n := 0
+	for _, c := range caches {
+		for _, s := range c.shards {
+			s.lck.Lock()
+			s.lru.Range(func(key string, value lru.Value, hot bool) bool {
+				if isChunkKey(key) {
+					n++
+				}
+				return true
+			})
+			s.lck.Unlock()
+		}
+	}
+	return n
+}
+
+func TestChunkedValueCleanup(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	missing := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	remote := newTestGroup(t, "chunk-cleanup-remote", 2<<10, missing, WithChunkSize(16), WithClock(clock))
+	g := newTestGroup(t, "chunk-cleanup", 2<<10, missing, WithChunkSize(16), WithClock(clock))
+	g.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool {
+		return isChunkKey(key) && (key[len(key)-1]-'0')%2 == 1
+	}})
+	waitChunks := func(want int, op string) {
+		t.Helper()
+		for i := 0; chunkKeys(g.mainCache, remote.mainCache) != want; i++ {
+			if i == 1000 {
+				t.Fatalf("expect %d chunks after %s, but got %d", want, op, chunkKeys(g.mainCache, remote.mainCache))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	value := []byte(strings.Repeat("0123456789", 10))
+	g.SetWithTags("large", value, "big")
+	waitChunks(7, "set")
+	// 覆盖后只保留新的分块
+	g.Set("large", value[:50])
+	waitChunks(4, "overwrite")
+	if v, err := g.Get("large"); err != nil || !bytes.Equal(v.ByteSlice(), value[:50]) {
+		t.Fatalf("expect new value after overwrite, but got %v %v", v, err)
+	}
+
+	g.Delete("large")
+	waitChunks(0, "delete")
+
+	g.Set("large", value)
+	g.DeletePattern("lar*")
+	waitChunks(0, "delete pattern")
+
+	g.SetWithTags("large", value, "big")
+	g.InvalidateTag("big")
+	waitChunks(0, "invalidate tag")
+
+	// 版本号冲突时新写入的分块不会被引用
+	g.Set("large", value)
+	if _, err := g.CompareAndSwap("large", 1, value); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expect ErrVersionConflict, but got %v", err)
+	}
+	waitChunks(7, "version conflict")
+
+	// 清单过期后删除分块
+	clock.Advance(expireTime + time.Second)
+	if _, err := g.Get("large"); !IsNotFound(err) {
+		t.Fatalf("expect large value expired, but got %v", err)
+	}
+	waitChunks(0, "expire")
+}
+
+func TestCompression(t *testing.T) {
+	for _, codec := range []Codec{FlateCodec(-1), GzipCodec(-1)} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			g := newTestGroup(t, "compress-"+codec.Name(), 2<<10, GetterFunc(func(key string) ([]byte, error) {
+				return nil, &NotFoundError{Key: key}
+			}), WithCompression(codec, 64), WithChunkSize(1<<20))
+			value := []byte(strings.Repeat(`{"name":"Tom","score":630},`, 40))
+			g.SetLocally("json", value, 0)
+			g.SetLocally("small", []byte(`{"name":"Tom"}`), 0)
+
+			it, _, _ := g.mainCache.get("json")
+			if it.view.codec == nil || it.Len() >= len(value) {
+				t.Fatalf("expect value compressed, but got %d bytes", it.Len())
+			}
+			if it, _, _ := g.mainCache.get("small"); it.view.codec != nil {
+				t.Fatalf("expect value under threshold not compressed")
+			}
+			v, err := g.Get("json")
+			if err != nil || v.Len() != len(value) || v.String() != string(value) || !bytes.Equal(v.ByteSlice(), value) {
+				t.Fatalf("expect value decompressed, but got %v %v", v, err)
+			}
+			if v.codec != nil {
+				t.Fatalf("expect value returned decompressed")
+			}
+
+			stats := g.Stats()
+			if stats.UncompressedBytes != int64(len(value)) || stats.CompressionRatio <= 0 || stats.CompressionRatio >= 1 {
+				t.Fatalf("unexpected compression stats: %+v", stats)
+			}
+			if used := stats.HeatBytes + stats.ColdBytes; used >= int64(len(value)) {
+				t.Fatalf("expect capacity counted by compressed size, but used %d", used)
+			}
+
+			// 无法解压的值返回错误并从缓存中删除
+			g.SetLocally("broken", value, 0)
+			broken, _, _ := g.mainCache.get("broken")
+			for i := range broken.view.data {
+				broken.view.data[i] = 0xff
+			}
+			if _, err := g.Get("broken"); err == nil || IsNotFound(err) {
+				t.Fatalf("expect decompress error, but got %v", err)
+			}
+			if _, _, ok := g.mainCache.get("broken"); ok {
+				t.Fatalf("expect broken value dropped")
+			}
+
+			// 快照中保存解压后的数据,恢复后重新压缩
+			var buf bytes.Buffer
+			if err := g.SaveSnapshot(&buf); err != nil {
+				t.Fatalf("save snapshot failed: %v", err)
+			}
+			restored := newTestGroup(t, "compress-restored", 2<<10, g.getter, WithCompression(codec, 64))
+			if _, err := restored.LoadSnapshot(&buf); err != nil {
+				t.Fatalf("load snapshot failed: %v", err)
+			}
+			if v, err := restored.Get("json"); err != nil || v.String() != string(value) {
+				t.Fatalf("expect compressed value restored, but got %v %v", v, err)
+			}
+		})
+	}
+}
+
+func TestByteView(t *testing.T) {
+	const s = "hello, TDKCache"
+	compressed, _ := FlateCodec(-1).Compress([]byte(s))
+	decompressed, err := ByteView{data: compressed, codec: FlateCodec(-1), n: len(s)}.decompress()
+	if err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	views := map[string]ByteView{
+		"bytes":        {data: []byte(s)},
+		"string":       StringView(s),
+		"decompressed": decompressed,
+		// 压缩的值在访问时解压
+		"compressed": {data: compressed, codec: FlateCodec(-1), n: len(s)},
+	}
+	for name, v := range views {
+		t.Run(name, func(t *testing.T) {
+			if v.Len() != len(s) || v.String() != s || string(v.ByteSlice()) != s || string(v.UnsafeBytes()) != s {
+				t.Fatalf("unexpected content: %q", v.String())
+			}
+			if v.At(7) != 'T' || v.Slice(7, 10).String() != "TDK" || v.SliceFrom(10).String() != "Cache" {
+				t.Fatalf("unexpected At or Slice result")
+			}
+			dst := make([]byte, 5)
+			if n := v.Copy(dst); n != 5 || string(dst) != "hello" {
+				t.Fatalf("expect 5 bytes copied, but got %d %q", n, dst)
+			}
+			for other, ov := range views {
+				if !v.Equal(ov) {
+					t.Fatalf("expect equal to %s view", other)
+				}
+			}
+			if !v.EqualString(s) || !v.EqualBytes([]byte(s)) || v.EqualString("hello") || v.Equal(StringView("hello")) {
+				t.Fatalf("unexpected EqualString or EqualBytes result")
+			}
+
+			r := v.Reader()
+			if _, err := r.Seek(7, io.SeekStart); err != nil {
+				t.Fatalf("seek failed: %v", err)
+			}
+			if b, _ := io.ReadAll(r); string(b) != "TDKCache" {
+				t.Fatalf("expect read TDKCache after seek, but got %q", b)
+			}
+			var buf bytes.Buffer
+			if n, err := v.WriteTo(&buf); err != nil || n != int64(len(s)) || buf.String() != s {
+				t.Fatalf("expect %d bytes written, but got %d %v", len(s), n, err)
+			}
+		})
+	}
+
+	// 无法解压的值在访问时panic,而不是返回压缩后的数据
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect panic when accessing broken compressed value")
+		}
+	}()
+	_ = ByteView{data: []byte("broken"), codec: FlateCodec(-1), n: len(s)}.String()
+}
+
+func TestScan(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "scan", 8<<10, getter, WithClock(clock), WithShards(4))
+	want := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("user:%02d", i)
+		g.SetLocally(key, []byte("v"), time.Minute)
+		want[key] = true
+	}
+	g.SetLocally("order:1", []byte("v"), 0)
+	g.Get("user:missing") // 负缓存不会被返回
+
+	got := make(map[string]bool)
+	cursor, pages := "", 0
+	for {
+		keys, next, err := g.Scan("user:", cursor, 7)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		if len(keys) > 7 {
+			t.Fatalf("expect at most 7 keys per page, but got %d", len(keys))
+		}
+		for _, k := range keys {
+			if got[k.Key] || !want[k.Key] {
+				t.Fatalf("unexpected or duplicated key %s", k.Key)
+			}
+			if k.Size != 1 || k.TTL != time.Minute {
+				t.Fatalf("unexpected key info: %+v", k)
+			}
+			got[k.Key] = true
+		}
+		pages++
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if len(got) != len(want) || pages < 5 {
+		t.Fatalf("expect %d keys in at least 5 pages, but got %d in %d pages", len(want), len(got), pages)
+	}
+
+	keys, next, _ := g.Scan("order:", "", 0)
+	if len(keys) != 1 || next != "" || keys[0].TTL != expireTime {
+		t.Fatalf("expect only order:1, but got %+v %q", keys, next)
+	}
+	if _, _, err := g.Scan("", "not a cursor!", 10); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expect ErrInvalidCursor, but got %v", err)
+	}
+
+	remote := newTestGroup(t, "scan-remote", 8<<10, getter, WithClock(clock))
+	remote.SetLocally("user:remote", []byte("v"), time.Minute)
+	g.RegisterPeers(&groupPeer{g: remote, owns: func(string) bool { return false }})
+	all, err := g.ScanEverywhere(context.Background(), "user:", 100)
+	if err != nil || len(all) != len(want)+1 {
+		t.Fatalf("expect %d keys from all nodes, but got %d %v", len(want)+1, len(all), err)
+	}
+}
+
+func TestKeyIndex(t *testing.T) {
+	x := newKeyIndex()
+	want := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("key%d", rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			x.remove(key)
+			delete(want, key)
+		} else {
+			x.insert(key)
+			want[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(want))
+	for key := range want {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	var got []string
+	for n := x.seek(""); n != nil; n = n.next[0] {
+		got = append(got, n.key)
+	}
+	if !reflect.DeepEqual(got, sorted) {
+		t.Fatalf("expect %d sorted keys, but got %d", len(sorted), len(got))
+	}
+	if n := x.seek(sorted[10] + "\x00"); n == nil || n.key != sorted[11] {
+		t.Fatalf("expect seek to return the key after %s", sorted[10])
+	}
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "lifecycle", 2<<10, getter, WithAppendLog(dir, FsyncAlways))
+	if _, err := NewGroup("lifecycle", 2<<10, getter); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("expect ErrGroupExists, but got %v", err)
+	}
+	if GetGroup("lifecycle") != g {
+		t.Fatalf("expect existing group not replaced")
+	}
+	other := newTestGroup(t, "lifecycle-other", 2<<10, getter)
+	names := ListGroups()
+	if i := sort.SearchStrings(names, "lifecycle"); i+1 >= len(names) || names[i] != "lifecycle" || names[i+1] != "lifecycle-other" {
+		t.Fatalf("expect both groups listed in order, but got %v", names)
+	}
+
+	g.SetLocally("key", []byte("value"), time.Minute)
+	if err := DestroyGroup("lifecycle"); err != nil {
+		t.Fatalf("destroy group failed: %v", err)
+	}
+	if err := DestroyGroup("lifecycle"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("expect ErrGroupNotFound, but got %v", err)
+	}
+	if GetGroup("lifecycle") != nil || GetGroup("lifecycle-other") != other {
+		t.Fatalf("expect only destroyed group unregistered")
+	}
+	select {
+	case <-g.mainCache.stopChan:
+	default:
+		t.Fatalf("expect expiry goroutine stopped")
+	}
+	if g.mainCache.len() != 0 {
+		t.Fatalf("expect cached data released")
+	}
+	if _, err := g.Get("key"); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expect ErrGroupClosed, but got %v", err)
+	}
+	if err := g.SetLocally("key", []byte("new"), 0); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expect ErrGroupClosed, but got %v", err)
+	}
+	if err := g.Delete("key"); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expect ErrGroupClosed, but got %v", err)
+	}
+	if err := g.DeleteEverywhere("key"); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expect ErrGroupClosed, but got %v", err)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatalf("expect closing twice to be safe, but got %v", err)
+	}
+
+	// 同名的group可以重新创建,并从追加日志恢复数据
+	recreated := newTestGroup(t, "lifecycle", 2<<10, getter, WithAppendLog(dir, FsyncAlways))
+	if v, err := recreated.Get("key"); err != nil || v.String() != "value" {
+		t.Fatalf("expect key restored after recreating group, but got %v %v", v, err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	g := newTestGroup(t, "cas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "loaded" {
+			return []byte("v0"), nil
+		}
+		return nil, &NotFoundError{Key: key}
+	}))
+
+	// 版本号0表示key必须不存在
+	v1, err := g.CompareAndSwap("k", 0, []byte("v1"))
+	if err != nil || v1 == 0 {
+		t.Fatalf("expect key created with version 0, but got %d %v", v1, err)
+	}
+	if _, err = g.CompareAndSwap("k", 0, []byte("v1")); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expect ErrVersionConflict for existing key, but got %v", err)
+	}
+	if v, version, err := g.GetWithVersion("k"); err != nil || v.String() != "v1" || version != v1 {
+		t.Fatalf("expect v1 with version %d, but got %v %d %v", v1, v, version, err)
+	}
+
+	v2, err := g.CompareAndSwap("k", v1, []byte("v2"))
+	if err != nil || v2 <= v1 {
+		t.Fatalf("expect version increased after swap, but got %d %v", v2, err)
+	}
+	if _, err = g.CompareAndSwap("k", v1, []byte("v3")); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expect ErrVersionConflict for stale version, but got %v", err)
+	}
+	if v, _ := g.Get("k"); v.String() != "v2" {
+		t.Fatalf("expect v2 kept after conflict, but got %v", v)
+	}
+
+	// 普通写入同样改变版本号
+	g.Set("k", []byte("v4"))
+	if _, err = g.CompareAndSwap("k", v2, []byte("v5")); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expect ErrVersionConflict after Set, but got %v", err)
+	}
+
+	// 通过Getter加载的值也有版本号
+	if _, version, err := g.GetWithVersion("loaded"); err != nil || version == 0 {
+		t.Fatalf("expect version of loaded value, but got %d %v", version, err)
+	}
+
+	// key由远程节点负责时CAS在远程节点执行
+	missing := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	remote := newTestGroup(t, "cas-remote", 2<<10, missing)
+	local := newTestGroup(t, "cas-local", 2<<10, missing)
+	local.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool { return true }})
+	rv, err := local.CompareAndSwap("r", 0, []byte("remote"))
+	if err != nil {
+		t.Fatalf("remote cas failed: %v", err)
+	}
+	if v, version, err := remote.GetWithVersion("r"); err != nil || v.String() != "remote" || version != rv {
+		t.Fatalf("expect value swapped on remote with version %d, but got %v %d %v", rv, v, version, err)
+	}
+	if _, version, _ := local.GetWithVersion("r"); version != rv {
+		t.Fatalf("expect version %d read from remote, but got %d", rv, version)
+	}
+	if _, err = local.CompareAndSwap("r", rv+1, []byte("stale")); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expect ErrVersionConflict from remote, but got %v", err)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	missing := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	g := newTestGroup(t, "counter", 2<<10, missing, WithClock(clock), WithExpiration(AbsoluteExpiration, 0))
+
+	if n, err := g.Incr("hits", 1); err != nil || n != 1 {
+		t.Fatalf("expect counter started from 0, but got %d %v", n, err)
+	}
+	if n, err := g.Incr("hits", 5); err != nil || n != 6 {
+		t.Fatalf("expect 6 after incr, but got %d %v", n, err)
+	}
+	if n, err := g.Decr("hits", 10); err != nil || n != -4 {
+		t.Fatalf("expect -4 after decr, but got %d %v", n, err)
+	}
+	if v, err := g.Get("hits"); err != nil || v.String() != "-4" {
+		t.Fatalf("expect counter stored as decimal, but got %v %v", v, err)
+	}
+
+	// 初始值和存活时间只在key不存在时生效,之后的计算保持原来的过期时间
+	ctx := context.Background()
+	if n, err := g.IncrContext(ctx, "window", 1, 100, time.Second); err != nil || n != 101 {
+		t.Fatalf("expect counter started from initial value, but got %d %v", n, err)
+	}
+	clock.Advance(time.Millisecond * 600)
+	if n, err := g.IncrContext(ctx, "window", 1, 100, time.Second); err != nil || n != 102 {
+		t.Fatalf("expect initial value ignored for existing key, but got %d %v", n, err)
+	}
+	clock.Advance(time.Millisecond * 400)
+	if n, err := g.IncrContext(ctx, "window", 1, 100, time.Second); err != nil || n != 101 {
+		t.Fatalf("expect counter restarted after expiration, but got %d %v", n, err)
+	}
+
+	g.Set("text", []byte("abc"))
+	if _, err := g.Incr("text", 1); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("expect ErrNotInteger, but got %v", err)
+	}
+	g.Set("max", []byte(strconv.FormatInt(math.MaxInt64, 10)))
+	if _, err := g.Incr("max", 1); !errors.Is(err, ErrCounterOverflow) {
+		t.Fatalf("expect ErrCounterOverflow, but got %v", err)
+	}
+	if v, _ := g.Get("max"); v.String() != strconv.FormatInt(math.MaxInt64, 10) {
+		t.Fatalf("expect value kept after overflow, but got %v", v)
+	}
+
+	// 并发计算不会丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Incr("concurrent", 2)
+		}()
+	}
+	wg.Wait()
+	if v, _ := g.Get("concurrent"); v.String() != "100" {
+		t.Fatalf("expect 100 after concurrent incr, but got %v", v)
+	}
+
+	// key由远程节点负责时在远程节点计算
+	remote := newTestGroup(t, "counter-remote", 2<<10, missing)
+	local := newTestGroup(t, "counter-local", 2<<10, missing)
+	local.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool { return true }})
+	local.Incr("r", 3)
+	if n, err := local.Decr("r", 1); err != nil || n != 2 {
+		t.Fatalf("expect remote counter 2, but got %d %v", n, err)
+	}
+	if v, err := remote.Get("r"); err != nil || v.String() != "2" {
+		t.Fatalf("expect counter stored on remote, but got %v %v", v, err)
+	}
+	if local.mainCache.len() != 0 {
+		t.Fatalf("expect nothing cached locally, but got %d keys", local.mainCache.len())
+	}
+}
+
+// taggedKeys 返回缓存中带有tag的key数量
+func taggedKeys(c *cache, tag string) int {
+	n := 0
+	for _, s := range c.shards {
+		s.lck.Lock()
+		n += len(s.tags[tag])
+		s.lck.Unlock()
+	}
+	return n
+}
+
+func TestTagInvalidation(t *testing.T) {
+	clock := timingwheel.NewFakeClock(time.Unix(1700000000, 0))
+	missing := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	remote := newTestGroup(t, "tag-remote", 2<<10, missing)
+	g := newTestGroup(t, "tag", 2<<10, missing, WithClock(clock))
+	g.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool { return strings.HasPrefix(key, "r:") }})
+
+	g.SetWithTags("list:1", []byte("a"), "user:1", "list")
+	g.SetWithTags("agg:1", []byte("b"), "user:1")
+	g.SetWithTags("r:view:1", []byte("c"), "user:1")
+	g.SetWithTags("list:2", []byte("d"), "user:2", "list")
+	if n, err := g.InvalidateTag("user:1"); err != nil || n != 3 {
+		t.Fatalf("expect 3 keys invalidated on all nodes, but got %d %v", n, err)
+	}
+	for _, key := range []string{"list:1", "agg:1", "r:view:1"} {
+		if _, err := g.Get(key); !IsNotFound(err) {
+			t.Fatalf("expect key [%s] invalidated, but got %v", key, err)
+		}
+	}
+	if v, err := g.Get("list:2"); err != nil || v.String() != "d" {
+		t.Fatalf("expect key with other tag kept, but got %v %v", v, err)
+	}
+	if n := taggedKeys(g.mainCache, "list"); n != 1 {
+		t.Fatalf("expect invalidated key removed from other tags, but got %d", n)
+	}
+
+	// 覆盖写入后使用新的标签,计数器和比较并替换保留原来的标签
+	g.SetWithTags("k", []byte("1"), "old")
+	g.Set("k", []byte("2"))
+	if n, _ := g.InvalidateTag("old"); n != 0 {
+		t.Fatalf("expect tag dropped after overwrite, but %d keys invalidated", n)
+	}
+	g.SetWithTags("counter", []byte("1"), "counter")
+	g.Incr("counter", 1)
+	if n, _ := g.InvalidateTag("counter"); n != 1 {
+		t.Fatalf("expect tag kept after incr, but %d keys invalidated", n)
+	}
+	g.SetWithTags("swapped", []byte("1"), "swapped")
+	res := g.GetVersioned(context.Background(), "swapped")
+	if _, err := g.CompareAndSwap("swapped", res.Version, []byte("2")); err != nil {
+		t.Fatalf("compare and swap failed: %v", err)
+	}
+	if n, _ := g.InvalidateTag("swapped"); n != 1 {
+		t.Fatalf("expect tag kept after compare and swap, but %d keys invalidated", n)
+	}
+
+	// 过期和被淘汰的key从索引中删除
+	g.SetWithTagsContext(context.Background(), "short", []byte("e"), time.Millisecond*100, []string{"short"})
+	clock.Advance(time.Millisecond * 100)
+	g.mainCache.removeExpired()
+	if n := taggedKeys(g.mainCache, "short"); n != 0 {
+		t.Fatalf("expect expired key removed from tag index, but got %d", n)
+	}
+	for i := 0; i < 100; i++ {
+		g.SetWithTags(fmt.Sprintf("bulk:%d", i), bytes.Repeat([]byte("x"), 100), "bulk")
+	}
+	live := 0
+	for i := 0; i < 100; i++ {
+		if _, _, ok := g.mainCache.get(fmt.Sprintf("bulk:%d", i)); ok {
+			live++
+		}
+	}
+	if n := taggedKeys(g.mainCache, "bulk"); live == 100 || n != live {
+		t.Fatalf("expect tag index matches %d cached keys, but got %d", live, n)
+	}
+
+	// 标签随快照保存和恢复
+	g.SetWithTags("snap", []byte("f"), "snap")
+	var buf bytes.Buffer
+	if err := g.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("save snapshot failed: %v", err)
+	}
+	restored := newTestGroup(t, "tag-restored", 2<<10, missing, WithClock(clock))
+	if _, err := restored.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("load snapshot failed: %v", err)
+	}
+	if n, _ := restored.InvalidateTagLocally("snap"); n != 1 {
+		t.Fatalf("expect tag restored from snapshot, but %d keys invalidated", n)
+	}
+	rec := aofRecord{op: opSet, key: "snap", value: []byte("f"), expireAt: clock.Now(), ttl: time.Second, tags: []string{"a", "b"}}
+	data := encodeAOFRecord(rec)
+	if got, err := decodeAOFRecord(data[4 : len(data)-4]); err != nil || !reflect.DeepEqual(got.tags, rec.tags) {
+		t.Fatalf("expect tags kept in append log, but got %v %v", got.tags, err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"user:123:*", "user:123:profile", true},
+		{"user:123:*", "user:1234:profile", false},
+		{"user:*:profile", "user:1/2:profile", true},
+		{"user:?", "user:1", true},
+		{"user:?", "user:12", false},
+		{"user:[12]", "user:2", true},
+		{"user:[!12]", "user:2", false},
+		{"user:[a-c]*", "user:b9", true},
+		{`user:\*`, "user:*", true},
+		{`user:\*`, "user:1", false},
+		{"a.b", "axb", false},
+		{escapeGlob("a*[b]?") + "*", "a*[b]?c", true},
+		{escapeGlob("a*[b]?") + "*", "aX[b]?c", false},
+	}
+	for _, tt := range tests {
+		re, err := compileGlob(tt.pattern)
+		if err != nil {
+			t.Fatalf("compile %q failed: %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.key); got != tt.match {
+			t.Fatalf("expect %q match %q = %v, but got %v", tt.pattern, tt.key, tt.match, got)
+		}
+	}
+	for _, pattern := range []string{"user:[12", `user:\`, "user:[]"} {
+		if _, err := compileGlob(pattern); !errors.Is(err, ErrInvalidPattern) {
+			t.Fatalf("expect ErrInvalidPattern for %q, but got %v", pattern, err)
+		}
+	}
+}
+
+func TestDeletePattern(t *testing.T) {
+	missing := GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	})
+	remote := newTestGroup(t, "pattern-remote", 2<<10, missing)
+	g := newTestGroup(t, "pattern", 2<<10, missing, WithHotCache(1<<10, time.Minute), WithHotAdmission(SampleAdmission(1)))
+	g.RegisterPeers(&groupPeer{g: remote, owns: func(key string) bool { return strings.HasSuffix(key, ":remote") }})
+
+	for _, key := range []string{"user:123:a", "user:123:b", "user:123:remote", "user:1234:a", "order:123:a"} {
+		g.Set(key, []byte("v"))
+	}
+	// 远程key的热点副本同样被删除
+	if _, err := g.Get("user:123:remote"); err != nil {
+		t.Fatalf("get remote key failed: %v", err)
+	}
+	if _, _, ok := g.hotCache.get("user:123:remote"); !ok {
+		t.Fatalf("expect remote key in hot cache")
+	}
+
+	if n, err := g.DeletePrefix("user:123:"); err != nil || n != 3 {
+		t.Fatalf("expect 3 keys deleted by prefix, but got %d %v", n, err)
+	}
+	if _, _, ok := g.hotCache.get("user:123:remote"); ok {
+		t.Fatalf("expect hot copy deleted")
+	}
+	for _, key := range []string{"user:123:a", "user:123:b", "user:123:remote"} {
+		if _, err := g.Get(key); !IsNotFound(err) {
+			t.Fatalf("expect key [%s] deleted, but got %v", key, err)
+		}
+	}
+
+	// 负缓存被删除但不计数
+	if n, err := g.DeletePattern("*:123:*"); err != nil || n != 1 {
+		t.Fatalf("expect 1 key deleted by pattern, but got %d %v", n, err)
+	}
+	if v, err := g.Get("user:1234:a"); err != nil || v.String() != "v" {
+		t.Fatalf("expect unmatched key kept, but got %v %v", v, err)
+	}
+	if _, err := g.DeletePattern("user:[1"); !errors.Is(err, ErrInvalidPattern) {
+		t.Fatalf("expect ErrInvalidPattern, but got %v", err)
+	}
+	if _, err := g.DeletePrefix(""); err == nil {
+		t.Fatalf("expect error for empty prefix")
+	}
+}
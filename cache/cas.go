@@ -0,0 +1,162 @@
+package mycache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVersionConflict 表示CompareAndSwap时key的版本号已经改变
+var ErrVersionConflict = errors.New("version conflict")
+
+// GetWithVersion 返回key对应的值以及版本号,版本号用于CompareAndSwap.
+// 总是从负责该key的节点读取,不使用热点缓存
+func (g *Group) GetWithVersion(key string) (ByteView, uint64, error) {
+	res := g.GetVersioned(context.Background(), key)
+	return res.Value, res.Version, res.Err
+}
+
+// GetVersioned 与GetWithVersion相同,同时返回剩余存活时间,ctx会传递到远程节点和Getter
+func (g *Group) GetVersioned(ctx context.Context, key string) Result {
+	if key == "" {
+		return Result{Key: key, Err: fmt.Errorf("key is required")}
+	}
+	if g.closed.Load() {
+		return Result{Key: key, Err: ErrGroupClosed}
+	}
+
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			r, err := peer.GetVersion(ctx, g.name, key)
+			if err != nil {
+				if !IsNotFound(err) {
+					groupLogger.Info("failed to get version of key [%s] from peer: %v", key, err)
+				}
+				return Result{Key: key, Err: err}
+			}
+			return Result{Key: key, Value: ByteView{data: r.Value}, TTL: r.TTL, Version: r.Version}
+		}
+	}
+
+	res, ok := g.lookup(key, false)
+	if !ok {
+		res = g.loadResult(ctx, key)
+	}
+	if res.Err != nil {
+		return Result{Key: key, Err: res.Err}
+	}
+	if res.Value, res.Err = g.resolveChunks(ctx, res); res.Err != nil {
+		return Result{Key: key, Err: res.Err}
+	}
+	res.manifest = false
+	return res
+}
+
+// CompareAndSwap 在key当前的版本号等于oldVersion时写入newValue并返回新的版本号,使用默认的过期时间.
+// oldVersion为0表示只在key不存在时写入,版本号不一致时返回ErrVersionConflict.
+// 版本号只在缓存中有效,key被淘汰或过期后需要重新获取版本号.替换时保留key原来的标签
+func (g *Group) CompareAndSwap(key string, oldVersion uint64, newValue []byte) (uint64, error) {
+	return g.CompareAndSwapContext(context.Background(), key, oldVersion, newValue, 0)
+}
+
+// CompareAndSwapContext 与CompareAndSwap相同,ttl小于等于0时使用默认的过期时间,ctx会传递到远程节点
+func (g *Group) CompareAndSwapContext(ctx context.Context, key string, oldVersion uint64, newValue []byte, ttl time.Duration) (uint64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+
+	if int64(len(newValue)) > g.chunkSize {
+		// 先写入分块,再比较并替换分块清单
+		manifest, err := g.storeChunks(ctx, key, newValue, ttl)
+		if err != nil {
+			groupLogger.Info("failed to swap key [%s]: %v", key, err)
+			return 0, err
+		}
+		version, err := g.compareAndSwap(ctx, key, oldVersion, manifest, ttl, true)
+		if err != nil {
+			// 版本号冲突或写入失败时清单没有写入,已经写入的分块不会被引用
+			g.dropChunks(key, manifest)
+		}
+		return version, err
+	}
+	return g.compareAndSwap(ctx, key, oldVersion, newValue, ttl, false)
+}
+
+// compareAndSwap 在负责key的节点上比较并替换key,manifest表示value是分块清单
+func (g *Group) compareAndSwap(ctx context.Context, key string, oldVersion uint64, value []byte, ttl time.Duration, manifest bool) (uint64, error) {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			g.removeHot(key)
+			var (
+				version uint64
+				err     error
+			)
+			if manifest {
+				version, err = peer.CompareAndSwapManifest(ctx, g.name, key, oldVersion, value, ttl)
+			} else {
+				version, err = peer.CompareAndSwap(ctx, g.name, key, oldVersion, value, ttl)
+			}
+			if err != nil && !errors.Is(err, ErrVersionConflict) {
+				groupLogger.Info("failed to swap key [%s] on peer: %v", key, err)
+			}
+			return version, err
+		}
+	}
+	if manifest {
+		return g.CompareAndSwapManifestLocally(key, oldVersion, value, ttl)
+	}
+	return g.CompareAndSwapLocally(key, oldVersion, value, ttl)
+}
+
+// CompareAndSwapLocally 在本地缓存中比较并替换key,不经过远程节点,用于处理其他节点转发的请求
+func (g *Group) CompareAndSwapLocally(key string, oldVersion uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return g.compareAndSwapLocally(key, oldVersion, value, ttl, false)
+}
+
+// CompareAndSwapManifestLocally 与CompareAndSwapLocally相同,写入的值是大对象的分块清单,见SetManifestLocally
+func (g *Group) CompareAndSwapManifestLocally(key string, oldVersion uint64, manifest []byte, ttl time.Duration) (uint64, error) {
+	if _, err := decodeManifest(manifest); err != nil {
+		return 0, fmt.Errorf("key [%s]: %w", key, err)
+	}
+	return g.compareAndSwapLocally(key, oldVersion, manifest, ttl, true)
+}
+
+func (g *Group) compareAndSwapLocally(key string, oldVersion uint64, value []byte, ttl time.Duration, manifest bool) (uint64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+
+	if ttl <= 0 {
+		ttl = expireTime
+	}
+	view := ByteView{data: cloneBytes(value)}
+	stored := view
+	if !manifest {
+		stored = g.compress(view)
+	}
+	it, err := g.mainCache.shard(key).write(key, func(old *item) (*item, []byte, time.Duration, error) {
+		var (
+			current uint64
+			tags    []string
+		)
+		if old != nil {
+			current, tags = old.version, old.tags
+		}
+		if current != oldVersion {
+			return nil, nil, 0, fmt.Errorf("%w: key [%s] expect version %d, but got %d", ErrVersionConflict, key, oldVersion, current)
+		}
+		return &item{view: stored, tags: tags, manifest: manifest}, view.data, ttl, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	g.removeHot(key)
+	return it.version, nil
+}
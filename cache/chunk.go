@@ -0,0 +1,228 @@
+package mycache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 超过chunkSize的值被切分为多个分块,每个分块以派生的key单独保存,
+// 通过一致性哈希分布到不同的节点.原key只保存分块清单,读取时按照清单重新组装.
+// 清单通过item.manifest标记,而不是根据值的内容识别,写入,追加日志和快照都会携带这个标记.
+//
+// 清单格式:
+//
+//	magic "TDKC" | version uint16 | id uint64 | 分块大小 uint64 | 分块数量 uint32 |
+//	总长度 uint64 | 值的CRC32 uint32 | 之前所有字节的CRC32 uint32
+//
+// 整数使用大端序.清单记录写入时的分块大小,各节点的分块大小可以不同.每次写入使用新的id,清单被覆盖,删除,过期或淘汰后其分块不会再被引用,
+// 负责原key的节点在后台删除这些分块
+const (
+	manifestMagic   = "TDKC"
+	manifestVersion = 2
+	manifestSize    = len(manifestMagic) + 2 + 8 + 8 + 4 + 8 + 4 + 4
+
+	chunkKeyPrefix    = "\x00chunk:" // 分块key的前缀,这类key不会通过Getter加载
+	defaultChunkRatio = 4            // 默认分块大小为每个分片容量的1/4
+	maxChunkRequests  = 8            // 同时写入的分块数量
+	maxChunks         = 1 << 16      // 单个值的最大分块数量
+)
+
+var (
+	// ErrChunkMissing 表示大对象的部分分块已经被淘汰或与清单不一致
+	ErrChunkMissing = errors.New("chunk missing")
+	// ErrInvalidManifest 表示分块清单格式错误,或分块数量与总长度不一致
+	ErrInvalidManifest = errors.New("invalid chunk manifest")
+	// ErrValueTooLarge 表示值需要的分块数量超过maxChunks
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrReservedKey 表示调用方传入的key使用了分块key的前缀
+	ErrReservedKey = errors.New("key uses reserved prefix")
+)
+
+// chunkManifest 是大对象的分块清单
+type chunkManifest struct {
+	id        uint64 // 本次写入的id,用于派生分块的key
+	chunkSize int64  // 写入时的分块大小
+	count     int    // 分块数量
+	size      int64  // 值的总长度
+	crc       uint32 // 值的CRC32
+}
+
+func (m chunkManifest) encode() []byte {
+	buf := make([]byte, 0, manifestSize)
+	buf = append(buf, manifestMagic...)
+	buf = binary.BigEndian.AppendUint16(buf, manifestVersion)
+	buf = binary.BigEndian.AppendUint64(buf, m.id)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(m.chunkSize))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(m.count))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(m.size))
+	buf = binary.BigEndian.AppendUint32(buf, m.crc)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeManifest 解析分块清单,并检查分块数量和总长度与清单中的分块大小一致
+func decodeManifest(data []byte) (m chunkManifest, err error) {
+	if len(data) != manifestSize || string(data[:len(manifestMagic)]) != manifestMagic {
+		return m, ErrInvalidManifest
+	}
+	body, sum := data[:manifestSize-4], data[manifestSize-4:]
+	if binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(body) {
+		return m, ErrInvalidManifest
+	}
+	body = body[len(manifestMagic):]
+	if binary.BigEndian.Uint16(body) != manifestVersion {
+		return m, ErrInvalidManifest
+	}
+	m.id = binary.BigEndian.Uint64(body[2:])
+	chunkSize := binary.BigEndian.Uint64(body[10:])
+	m.count = int(binary.BigEndian.Uint32(body[18:]))
+	m.size = int64(binary.BigEndian.Uint64(body[22:]))
+	m.crc = binary.BigEndian.Uint32(body[30:])
+	// 分块与其他值一样不超过maxSnapshotBytes,先限制分块大小和数量,之后的乘法不会溢出
+	if chunkSize == 0 || chunkSize > maxSnapshotBytes {
+		return m, fmt.Errorf("%w: chunk size %d", ErrInvalidManifest, chunkSize)
+	}
+	m.chunkSize = int64(chunkSize)
+	if m.count <= 0 || m.count > maxChunks || m.size <= int64(m.count-1)*m.chunkSize || m.size > int64(m.count)*m.chunkSize {
+		return m, fmt.Errorf("%w: %d chunks of %d bytes with chunk size %d", ErrInvalidManifest, m.count, m.size, m.chunkSize)
+	}
+	return m, nil
+}
+
+// chunkKey 返回key第i个分块的key
+func chunkKey(key string, id uint64, i int) string {
+	return fmt.Sprintf("%s%s:%x:%d", chunkKeyPrefix, key, id, i)
+}
+
+func isChunkKey(key string) bool {
+	return strings.HasPrefix(key, chunkKeyPrefix)
+}
+
+// checkKey 检查调用方传入的key,分块的key只能在切分大对象时写入
+func checkKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if isChunkKey(key) {
+		return fmt.Errorf("%w: %q", ErrReservedKey, key)
+	}
+	return nil
+}
+
+// storeChunks 将value切分后写入负责各分块的节点,返回分块清单.
+// 所有分块写入成功后才返回清单,保证读取到清单时分块已经存在
+func (g *Group) storeChunks(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error) {
+	size := int(g.chunkSize)
+	m := chunkManifest{
+		id:        rand.Uint64(),
+		chunkSize: g.chunkSize,
+		count:     (len(value) + size - 1) / size,
+		size:      int64(len(value)),
+		crc:       crc32.ChecksumIEEE(value),
+	}
+	if m.count > maxChunks {
+		return nil, fmt.Errorf("%w: key [%s] needs %d chunks", ErrValueTooLarge, key, m.count)
+	}
+	errs := make([]error, m.count)
+	sem := make(chan struct{}, maxChunkRequests)
+	var wg sync.WaitGroup
+	for i := 0; i < m.count; i++ {
+		end := (i + 1) * size
+		if end > len(value) {
+			end = len(value)
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = g.setValue(ctx, chunkKey(key, m.id, i), chunk, ttl, nil, false)
+		}(i, value[i*size:end])
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("store chunks of key [%s]: %w", key, err)
+	}
+	return m.encode(), nil
+}
+
+// dropChunks 在后台删除清单引用的所有分块,分块分布在各个节点,按照分块的key删除
+func (g *Group) dropChunks(key string, manifest []byte) {
+	m, err := decodeManifest(manifest)
+	if err != nil {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		var errs []error
+		for i := 0; i < m.count; i++ {
+			err := g.deleteValue(ctx, chunkKey(key, m.id, i))
+			if errors.Is(err, ErrGroupClosed) {
+				return
+			} else if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			groupLogger.Info("failed to drop %d of %d chunks of key [%s]: %v", len(errs), m.count, key, errs[0])
+		}
+	}()
+}
+
+// resolveChunks 在res的值是分块清单时读取并组装完整的值,否则直接返回res的值.
+// 清单无效或分块缺失时丢弃清单,下一次读取重新从数据源加载
+func (g *Group) resolveChunks(ctx context.Context, res Result) (ByteView, error) {
+	if !res.manifest {
+		return res.Value, nil
+	}
+	m, err := decodeManifest(res.Value.data)
+	if err == nil {
+		var value ByteView
+		if value, err = g.assemble(ctx, res.Key, m); err == nil {
+			return value, nil
+		}
+	}
+	if errors.Is(err, ErrInvalidManifest) || errors.Is(err, ErrChunkMissing) {
+		groupLogger.Info("drop manifest of key [%s]: %v", res.Key, err)
+		g.mainCache.deleteIf(res.Key, func(it *item) bool { return it.manifest && it.view.Equal(res.Value) })
+	}
+	return ByteView{}, err
+}
+
+// assemble 按照清单批量读取所有分块并拼接,任一分块缺失或校验失败时返回ErrChunkMissing.
+// 读取到所有分块后才按照实际的长度分配内存
+func (g *Group) assemble(ctx context.Context, key string, m chunkManifest) (ByteView, error) {
+	keys := make([]string, m.count)
+	for i := range keys {
+		keys[i] = chunkKey(key, m.id, i)
+	}
+	results := g.GetMultiContext(ctx, keys)
+	var n int64
+	for _, res := range results {
+		if IsNotFound(res.Err) {
+			return ByteView{}, fmt.Errorf("%w: %d chunks of key [%s]", ErrChunkMissing, m.count, key)
+		} else if res.Err != nil {
+			return ByteView{}, res.Err
+		}
+		n += int64(res.Value.Len())
+	}
+	if n != m.size {
+		return ByteView{}, fmt.Errorf("%w: chunks of key [%s] have %d bytes, expect %d", ErrChunkMissing, key, n, m.size)
+	}
+	data := make([]byte, 0, n)
+	for _, res := range results {
+		data = append(data, res.Value.bytes()...)
+	}
+	if crc32.ChecksumIEEE(data) != m.crc {
+		return ByteView{}, fmt.Errorf("%w: checksum mismatch of key [%s]", ErrChunkMissing, key)
+	}
+	return ByteView{data: data}, nil
+}
@@ -0,0 +1,109 @@
+package mycache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// 默认只压缩超过1KB的值,较小的值压缩收益有限
+const defaultCompressThreshold = 1 << 10
+
+// Codec 是值的压缩算法,需要能够被多个goroutine同时使用
+type Codec interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var codecs = map[string]Codec{
+	"flate": FlateCodec(flate.DefaultCompression),
+	"gzip":  GzipCodec(gzip.DefaultCompression),
+}
+
+// CodecByName 返回内置的压缩算法: flate, gzip
+func CodecByName(name string) (Codec, error) {
+	if c, ok := codecs[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown codec: %s", name)
+}
+
+// FlateCodec 使用DEFLATE压缩,level与compress/flate相同
+type FlateCodec int
+
+func (c FlateCodec) Name() string {
+	return "flate"
+}
+
+func (c FlateCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, int(c))
+	if err != nil {
+		return nil, err
+	}
+	return compress(&buf, w, src)
+}
+
+func (c FlateCodec) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// GzipCodec 使用gzip压缩,level与compress/gzip相同
+type GzipCodec int
+
+func (c GzipCodec) Name() string {
+	return "gzip"
+}
+
+func (c GzipCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, int(c))
+	if err != nil {
+		return nil, err
+	}
+	return compress(&buf, w, src)
+}
+
+func (c GzipCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func compress(buf *bytes.Buffer, w io.WriteCloser, src []byte) ([]byte, error) {
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compress 在开启压缩且值超过阈值时压缩view,压缩后没有变小时保留原值.
+// 分块清单不需要压缩,调用方直接保存
+func (g *Group) compress(view ByteView) ByteView {
+	if g.codec == nil || view.codec != nil || view.Len() < g.compressThreshold {
+		return view
+	}
+	raw := view.bytes()
+	data, err := g.codec.Compress(raw)
+	if err != nil {
+		groupLogger.Error("compress value with %s: %v", g.codec.Name(), err)
+		return view
+	}
+	if len(data) >= len(raw) {
+		return view
+	}
+	g.stats.uncompressedBytes.Add(int64(len(raw)))
+	g.stats.compressedBytes.Add(int64(len(data)))
+	return ByteView{data: data, codec: g.codec, n: len(raw)}
+}
@@ -0,0 +1,101 @@
+package mycache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotInteger 表示Incr/Decr的key中保存的值不是十进制整数
+	ErrNotInteger = errors.New("value is not an integer")
+	// ErrCounterOverflow 表示Incr/Decr的结果超出int64的范围
+	ErrCounterOverflow = errors.New("increment or decrement would overflow")
+)
+
+// Incr 将key中保存的十进制整数加上delta并返回结果,key不存在时从0开始,使用默认的过期时间.
+// 计数器只保存在缓存中,不会通过Getter加载
+func (g *Group) Incr(key string, delta int64) (int64, error) {
+	return g.IncrContext(context.Background(), key, delta, 0, 0)
+}
+
+// Decr 将key中保存的十进制整数减去delta并返回结果,见Incr
+func (g *Group) Decr(key string, delta int64) (int64, error) {
+	return g.DecrContext(context.Background(), key, delta, 0, 0)
+}
+
+// IncrContext 在负责key的节点上原子地将key加上delta.
+// key不存在时以initial为初始值,ttl为存活时间,小于等于0时使用默认的过期时间;
+// key已经存在时保持原来的过期时间.ctx会传递到远程节点
+func (g *Group) IncrContext(ctx context.Context, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			g.removeHot(key)
+			n, err := peer.Incr(ctx, g.name, key, delta, initial, ttl)
+			if err != nil {
+				groupLogger.Info("failed to incr key [%s] on peer: %v", key, err)
+			}
+			return n, err
+		}
+	}
+	return g.IncrLocally(key, delta, initial, ttl)
+}
+
+// DecrContext 在负责key的节点上原子地将key减去delta,见IncrContext
+func (g *Group) DecrContext(ctx context.Context, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, fmt.Errorf("%w: decr key [%s] by %d", ErrCounterOverflow, key, delta)
+	}
+	return g.IncrContext(ctx, key, -delta, initial, ttl)
+}
+
+// IncrLocally 在本地缓存中将key加上delta,不经过远程节点,用于处理其他节点转发的请求
+func (g *Group) IncrLocally(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+
+	var n int64
+	s := g.mainCache.shard(key)
+	_, err := s.write(key, func(old *item) (*item, []byte, time.Duration, error) {
+		n = initial
+		var tags []string
+		if old != nil {
+			view, err := old.view.decompress()
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			v, err := strconv.ParseInt(view.String(), 10, 64)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("%w: key [%s]", ErrNotInteger, key)
+			}
+			// 保持原来的过期时间
+			n, ttl, tags = v, s.keepTTLLocked(key), old.tags
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, nil, 0, fmt.Errorf("%w: key [%s] %d + %d", ErrCounterOverflow, key, n, delta)
+		}
+		n += delta
+		// 计数器的值很短,不需要压缩
+		data := strconv.AppendInt(nil, n, 10)
+		return &item{view: ByteView{data: data}, tags: tags}, data, ttl, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	g.removeHot(key)
+	return n, nil
+}
@@ -0,0 +1,22 @@
+package mycache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NotFoundError 表示key在数据源中不存在.
+// Getter返回该错误时,Group会缓存一条负缓存,在负缓存过期前不再访问数据源
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("key [%s] not found", e.Key)
+}
+
+// IsNotFound 判断err是否表示key不存在
+func IsNotFound(err error) bool {
+	var nf *NotFoundError
+	return errors.As(err, &nf)
+}
@@ -0,0 +1,97 @@
+package mycache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHotExpireTime = 10 // 默认热点缓存存活时间(秒)
+	defaultHotSampleRate = 10 // 默认每10次远程加载随机放入一次热点缓存
+	// 频率准入在记录这么多次访问后清空计数,使计数反映近期的访问情况
+	frequencyResetAfter = 10 << 10
+)
+
+// HotAdmission 决定从远程节点加载的key是否放入本地的热点缓存
+type HotAdmission interface {
+	Admit(key string) bool
+}
+
+type sampleAdmission struct {
+	rate int
+}
+
+// SampleAdmission 返回按照采样准入的策略,每次远程加载以1/rate的概率放入热点缓存,
+// 越热的key越快被放入
+func SampleAdmission(rate int) HotAdmission {
+	if rate < 1 {
+		rate = 1
+	}
+	return &sampleAdmission{rate: rate}
+}
+
+func (a *sampleAdmission) Admit(key string) bool {
+	return a.rate == 1 || rand.Intn(a.rate) == 0
+}
+
+type frequencyAdmission struct {
+	mu        sync.Mutex
+	threshold int
+	counts    map[string]int
+	total     int
+}
+
+// FrequencyAdmission 返回按照访问频率准入的策略,
+// 近期从远程加载达到threshold次的key放入热点缓存
+func FrequencyAdmission(threshold int) HotAdmission {
+	return &frequencyAdmission{threshold: threshold, counts: make(map[string]int)}
+}
+
+func (a *frequencyAdmission) Admit(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total++
+	if a.total > frequencyResetAfter {
+		a.counts = make(map[string]int)
+		a.total = 1
+	}
+	a.counts[key]++
+	if a.counts[key] >= a.threshold {
+		delete(a.counts, key)
+		return true
+	}
+	return false
+}
+
+// newHotCache 创建热点缓存,热点缓存中的数据在写入后固定时间过期,不随访问延长
+func newHotCache(o options) *cache {
+	if o.hotCapacity <= 0 {
+		return nil
+	}
+	return NewCache(o.hotCapacity, nil,
+		WithClock(o.clock),
+		WithPolicy(o.newPolicy),
+		WithShards(o.shards),
+		WithExpiration(AbsoluteExpiration, 0),
+	)
+}
+
+// populateHotCache 将从远程节点加载的数据按照准入策略放入热点缓存
+func (g *Group) populateHotCache(key string, value ByteView, ttl time.Duration) {
+	if g.hotCache == nil || int64(value.Len()) > g.chunkSize || !g.hotAdmission.Admit(key) {
+		// 大对象会挤占整个热点缓存,不进行缓存
+		return
+	}
+	if ttl <= 0 || ttl > g.hotTTL {
+		ttl = g.hotTTL
+	}
+	g.hotCache.add(key, g.compress(value), ttl)
+}
+
+// removeHot 删除热点缓存中的key
+func (g *Group) removeHot(key string) {
+	if g.hotCache != nil {
+		g.hotCache.delete(key)
+	}
+}
@@ -0,0 +1,237 @@
+package lru
+
+import "container/list"
+
+// ARCCache 是按字节计算容量的自适应替换缓存(Adaptive Replacement Cache).
+// t1保存只访问过一次的数据,t2保存访问过多次的数据,
+// b1和b2分别记录从t1和t2中淘汰的key(幽灵数据),
+// 根据幽灵数据的命中情况动态调整t1的目标大小p
+type ARCCache struct {
+	capacity  int64                         // 缓存容量
+	p         int64                         // t1的目标大小
+	t1, t2    *arcList                      // 缓存数据
+	b1, b2    *arcList                      // 幽灵数据,只保存key和大小
+	onEvicted func(key string, value Value) // 回调函数
+}
+
+type arcEntry struct {
+	key   string // 键
+	value Value  // 值,幽灵数据为nil
+	size  int64  // 数据大小
+}
+
+// arcList 是带有哈希表索引并记录总大小的LRU链表
+type arcList struct {
+	ll    *list.List
+	items map[string]*list.Element
+	size  int64
+}
+
+func newARCList() *arcList {
+	return &arcList{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *arcList) pushFront(e *arcEntry) {
+	l.items[e.key] = l.ll.PushFront(e)
+	l.size += e.size
+}
+
+func (l *arcList) remove(key string) *arcEntry {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*arcEntry)
+	l.ll.Remove(elem)
+	delete(l.items, key)
+	l.size -= e.size
+	return e
+}
+
+// removeBack 移除最久未使用的数据
+func (l *arcList) removeBack() *arcEntry {
+	elem := l.ll.Back()
+	if elem == nil {
+		return nil
+	}
+	return l.remove(elem.Value.(*arcEntry).key)
+}
+
+func NewARCCache(capacity int64, onEvicted func(key string, value Value)) *ARCCache {
+	return &ARCCache{
+		capacity:  capacity,
+		t1:        newARCList(),
+		t2:        newARCList(),
+		b1:        newARCList(),
+		b2:        newARCList(),
+		onEvicted: onEvicted,
+	}
+}
+
+func (c *ARCCache) Add(key string, value Value, _ int64) bool {
+	size := entrySize(key, value)
+	if size > c.capacity {
+		// 单条数据超过缓存容量,无法加入缓存
+		return false
+	}
+	e := &arcEntry{key: key, value: value, size: size}
+
+	// 已经在缓存中: 更新数据并移动到t2
+	if old := c.t1.remove(key); old != nil {
+		c.replace(false, size)
+		c.t2.pushFront(e)
+		return true
+	}
+	if old := c.t2.remove(key); old != nil {
+		c.replace(false, size)
+		c.t2.pushFront(e)
+		return true
+	}
+
+	// 命中b1: 说明t1过小,增大p
+	if ghost := c.b1.remove(key); ghost != nil {
+		delta := size
+		if c.b1.size > 0 && c.b2.size > c.b1.size {
+			delta = size * c.b2.size / c.b1.size
+		}
+		c.p = min64(c.capacity, c.p+delta)
+		c.replace(false, size)
+		c.t2.pushFront(e)
+		c.trimGhosts()
+		return true
+	}
+
+	// 命中b2: 说明t2过小,减小p
+	if ghost := c.b2.remove(key); ghost != nil {
+		delta := size
+		if c.b2.size > 0 && c.b1.size > c.b2.size {
+			delta = size * c.b1.size / c.b2.size
+		}
+		c.p = max64(0, c.p-delta)
+		c.replace(true, size)
+		c.t2.pushFront(e)
+		c.trimGhosts()
+		return true
+	}
+
+	// 新数据加入t1
+	c.replace(false, size)
+	c.t1.pushFront(e)
+	c.trimGhosts()
+	return true
+}
+
+func (c *ARCCache) Get(key string, _ int64) (Value, bool) {
+	if e := c.t1.remove(key); e != nil {
+		// 第二次访问,从t1移动到t2
+		c.t2.pushFront(e)
+		return e.value, true
+	}
+	if elem, ok := c.t2.items[key]; ok {
+		c.t2.ll.MoveToFront(elem)
+		return elem.Value.(*arcEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *ARCCache) Peek(key string) (Value, bool) {
+	if elem, ok := c.t1.items[key]; ok {
+		return elem.Value.(*arcEntry).value, true
+	}
+	if elem, ok := c.t2.items[key]; ok {
+		return elem.Value.(*arcEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *ARCCache) PeekRegion(key string) (Value, bool, bool) {
+	if elem, ok := c.t1.items[key]; ok {
+		return elem.Value.(*arcEntry).value, false, true
+	}
+	if elem, ok := c.t2.items[key]; ok {
+		return elem.Value.(*arcEntry).value, true, true
+	}
+	return nil, false, false
+}
+
+func (c *ARCCache) Delete(key string) bool {
+	e := c.t1.remove(key)
+	if e == nil {
+		e = c.t2.remove(key)
+	}
+	if e == nil {
+		return false
+	}
+	if c.onEvicted != nil {
+		c.onEvicted(e.key, e.value)
+	}
+	return true
+}
+
+func (c *ARCCache) Len() int {
+	return len(c.t1.items) + len(c.t2.items)
+}
+
+// Usage 将访问过多次的t2计入热数据区,t1计入冷数据区
+func (c *ARCCache) Usage() Usage {
+	return Usage{
+		HeatBytes: c.t2.size,
+		HeatItems: int64(len(c.t2.items)),
+		ColdBytes: c.t1.size,
+		ColdItems: int64(len(c.t1.items)),
+	}
+}
+
+// Range 先遍历t1,再遍历t2,不包含幽灵数据
+func (c *ARCCache) Range(fn func(key string, value Value, hot bool) bool) {
+	for _, l := range []*arcList{c.t1, c.t2} {
+		hot := l == c.t2
+		if !rangeList(l.ll, func(elem *list.Element) bool {
+			e := elem.Value.(*arcEntry)
+			return fn(e.key, e.value, hot)
+		}) {
+			return
+		}
+	}
+}
+
+// replace 淘汰数据直到能够放入大小为size的新数据,被淘汰的key加入对应的幽灵链表
+func (c *ARCCache) replace(inB2 bool, size int64) {
+	for c.t1.size+c.t2.size+size > c.capacity {
+		var e *arcEntry
+		if c.t1.size > 0 && (c.t1.size > c.p || (inB2 && c.t1.size == c.p) || c.t2.size == 0) {
+			e = c.t1.removeBack()
+			c.b1.pushFront(&arcEntry{key: e.key, size: e.size})
+		} else {
+			e = c.t2.removeBack()
+			c.b2.pushFront(&arcEntry{key: e.key, size: e.size})
+		}
+		if c.onEvicted != nil {
+			c.onEvicted(e.key, e.value)
+		}
+	}
+}
+
+// trimGhosts 限制幽灵数据的大小: t1+b1不超过容量,全部数据不超过两倍容量
+func (c *ARCCache) trimGhosts() {
+	for c.t1.size+c.b1.size > c.capacity && c.b1.ll.Len() > 0 {
+		c.b1.removeBack()
+	}
+	for c.t1.size+c.t2.size+c.b1.size+c.b2.size > 2*c.capacity && c.b2.ll.Len() > 0 {
+		c.b2.removeBack()
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,45 @@
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestARCScanResistance(t *testing.T) {
+	// 每条数据占用4字节,最多保存10条
+	arc := NewARCCache(int64(40), nil)
+	hot := []string{"h1", "h2", "h3"}
+	for _, key := range hot {
+		arc.Add(key, String("vv"), 0)
+		arc.Get(key, 0)
+	}
+
+	// 一次性扫描大量只访问一次的数据不应冲掉频繁访问的数据
+	for i := 0; i < 100; i++ {
+		arc.Add(fmt.Sprintf("s%d", i), String("v"), 0)
+	}
+	for _, key := range hot {
+		if _, ok := arc.Get(key, 0); !ok {
+			t.Fatalf("expect %s to survive the scan", key)
+		}
+	}
+}
+
+func TestARCGhostHit(t *testing.T) {
+	// 每条数据占用4字节,最多保存3条
+	arc := NewARCCache(int64(12), nil)
+	arc.Add("k1", String("v1"), 0)
+	arc.Get("k1", 0)
+	arc.Add("k2", String("v2"), 0)
+	arc.Add("k3", String("v3"), 0)
+	arc.Add("k4", String("v4"), 0)
+	if _, ok := arc.b1.items["k2"]; !ok {
+		t.Fatalf("expect k2 in ghost list b1")
+	}
+
+	// 命中b1会增大t1的目标大小,并将数据加入t2
+	arc.Add("k2", String("v2"), 0)
+	if _, ok := arc.t2.items["k2"]; !ok || arc.p == 0 {
+		t.Fatalf("expect k2 in t2 and p increased, got p=%d", arc.p)
+	}
+}
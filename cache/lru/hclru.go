@@ -62,8 +62,10 @@ func (c *HCCache) Add(key string, value Value, t int64) bool {
 		e.value = value
 		e.timestamp = t
 	} else if element, ok := c.coldCache[key]; ok {
-		// 如果数据在冷数据区,根据访问间隔判断是否需要移动到热数据区
+		// 如果数据在冷数据区,更新数据后根据访问间隔判断是否需要移动到热数据区
 		e := element.Value.(*hcEntry)
+		c.coldLength += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
 		if t-e.timestamp < 1000 {
 			// 如果间隔小于1s,加入热数据区
 			c.coldLinklist.Remove(element)
@@ -119,7 +121,25 @@ func (c *HCCache) Get(key string, t int64) (Value, bool) {
 
 }
 
-func (c *HCCache) Delete(key string) {
+func (c *HCCache) Peek(key string) (Value, bool) {
+	if elem, ok := c.heatCache[key]; ok {
+		return elem.Value.(*hcEntry).value, true
+	} else if elem, ok := c.coldCache[key]; ok {
+		return elem.Value.(*hcEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *HCCache) PeekRegion(key string) (Value, bool, bool) {
+	if elem, ok := c.heatCache[key]; ok {
+		return elem.Value.(*hcEntry).value, true, true
+	} else if elem, ok := c.coldCache[key]; ok {
+		return elem.Value.(*hcEntry).value, false, true
+	}
+	return nil, false, false
+}
+
+func (c *HCCache) Delete(key string) bool {
 	if elem, ok := c.heatCache[key]; ok {
 		c.heatLinklist.Remove(elem)
 		e := elem.Value.(*hcEntry)
@@ -136,7 +156,38 @@ func (c *HCCache) Delete(key string) {
 		if c.onEvicted != nil {
 			c.onEvicted(e.key, e.value)
 		}
+	} else {
+		return false
 	}
+	return true
+}
+
+// Range 先遍历冷数据区,再遍历热数据区
+func (c *HCCache) Range(fn func(key string, value Value, hot bool) bool) {
+	if !rangeList(c.coldLinklist, func(elem *list.Element) bool {
+		e := elem.Value.(*hcEntry)
+		return fn(e.key, e.value, false)
+	}) {
+		return
+	}
+	rangeList(c.heatLinklist, func(elem *list.Element) bool {
+		e := elem.Value.(*hcEntry)
+		return fn(e.key, e.value, true)
+	})
+}
+
+// Restore 将新数据直接放入热数据区或冷数据区,已经存在的数据按照Add处理
+func (c *HCCache) Restore(key string, value Value, hot bool, t int64) bool {
+	_, inHeat := c.heatCache[key]
+	_, inCold := c.coldCache[key]
+	if !hot || inHeat || inCold {
+		return c.Add(key, value, t)
+	}
+	e := NewEntry(key, value, t)
+	c.heatLength += int64(e.Len())
+	c.heatCache[key] = c.heatLinklist.PushFront(e)
+	c.replace()
+	return true
 }
 
 func (c *HCCache) replace() {
@@ -172,3 +223,12 @@ func (c *HCCache) replace() {
 func (c *HCCache) Len() int {
 	return c.coldLinklist.Len() + c.heatLinklist.Len()
 }
+
+func (c *HCCache) Usage() Usage {
+	return Usage{
+		HeatBytes: c.heatLength,
+		HeatItems: int64(c.heatLinklist.Len()),
+		ColdBytes: c.coldLength,
+		ColdItems: int64(c.coldLinklist.Len()),
+	}
+}
@@ -0,0 +1,197 @@
+package lru
+
+import (
+	"container/list"
+	"sort"
+)
+
+// LFUCache 淘汰访问次数最少的数据,访问次数相同时淘汰最久未使用的数据
+type LFUCache struct {
+	capacity   int64                         // 缓存容量
+	length     int64                         // 当前缓存大小
+	coldLength int64                         // 只访问过一次的数据大小
+	minFreq    int                           // 当前最小的访问次数
+	freqs      map[int]*list.List            // 以访问次数为索引的链表,链表头为最近访问的数据
+	cache      map[string]*list.Element      // 以key为索引的哈希表
+	onEvicted  func(key string, value Value) // 回调函数
+}
+
+type lfuEntry struct {
+	key   string // 键
+	value Value  // 值
+	freq  int    // 访问次数
+}
+
+func NewLFUCache(capacity int64, onEvicted func(key string, value Value)) *LFUCache {
+	return &LFUCache{
+		capacity:  capacity,
+		freqs:     make(map[int]*list.List),
+		cache:     make(map[string]*list.Element),
+		onEvicted: onEvicted,
+	}
+}
+
+func (c *LFUCache) Add(key string, value Value, _ int64) bool {
+	size := entrySize(key, value)
+	if size > c.capacity {
+		// 单条数据超过缓存容量,无法加入缓存
+		return false
+	}
+
+	if elem, ok := c.cache[key]; ok {
+		e := elem.Value.(*lfuEntry)
+		c.length += int64(value.Len()) - int64(e.value.Len())
+		if e.freq == 1 {
+			c.coldLength += int64(value.Len()) - int64(e.value.Len())
+		}
+		e.value = value
+		c.touch(elem)
+		for c.length > c.capacity {
+			c.removeLeastFrequent()
+		}
+		return true
+	}
+
+	// 新数据加入前先腾出空间,避免新数据被立即淘汰
+	for c.length+size > c.capacity {
+		c.removeLeastFrequent()
+	}
+	e := &lfuEntry{key: key, value: value, freq: 1}
+	c.cache[key] = c.freqList(1).PushFront(e)
+	c.length += size
+	c.coldLength += size
+	c.minFreq = 1
+	return true
+}
+
+func (c *LFUCache) Get(key string, _ int64) (Value, bool) {
+	if elem, ok := c.cache[key]; ok {
+		c.touch(elem)
+		return elem.Value.(*lfuEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *LFUCache) Peek(key string) (Value, bool) {
+	if elem, ok := c.cache[key]; ok {
+		return elem.Value.(*lfuEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *LFUCache) PeekRegion(key string) (Value, bool, bool) {
+	if elem, ok := c.cache[key]; ok {
+		e := elem.Value.(*lfuEntry)
+		return e.value, e.freq > 1, true
+	}
+	return nil, false, false
+}
+
+func (c *LFUCache) Delete(key string) bool {
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem)
+	return true
+}
+
+func (c *LFUCache) Len() int {
+	return len(c.cache)
+}
+
+// Usage 将访问过多次的数据计入热数据区,只访问过一次的数据计入冷数据区
+func (c *LFUCache) Usage() Usage {
+	var coldItems int64
+	if l, ok := c.freqs[1]; ok {
+		coldItems = int64(l.Len())
+	}
+	return Usage{
+		HeatBytes: c.length - c.coldLength,
+		HeatItems: int64(len(c.cache)) - coldItems,
+		ColdBytes: c.coldLength,
+		ColdItems: coldItems,
+	}
+}
+
+// touch 将数据的访问次数加1
+func (c *LFUCache) touch(elem *list.Element) {
+	e := elem.Value.(*lfuEntry)
+	c.unlink(elem)
+	if e.freq == c.minFreq && c.freqs[e.freq] == nil {
+		c.minFreq++
+	}
+	if e.freq == 1 {
+		c.coldLength -= entrySize(e.key, e.value)
+	}
+	e.freq++
+	c.cache[e.key] = c.freqList(e.freq).PushFront(e)
+}
+
+// Range 按照访问次数从少到多遍历,访问过多次的数据计入热数据区
+func (c *LFUCache) Range(fn func(key string, value Value, hot bool) bool) {
+	freqs := make([]int, 0, len(c.freqs))
+	for freq := range c.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Ints(freqs)
+	for _, freq := range freqs {
+		if !rangeList(c.freqs[freq], func(elem *list.Element) bool {
+			e := elem.Value.(*lfuEntry)
+			return fn(e.key, e.value, e.freq > 1)
+		}) {
+			return
+		}
+	}
+}
+
+// unlink 将数据从所在的访问次数链表中移除
+func (c *LFUCache) unlink(elem *list.Element) {
+	e := elem.Value.(*lfuEntry)
+	l := c.freqs[e.freq]
+	l.Remove(elem)
+	if l.Len() == 0 {
+		delete(c.freqs, e.freq)
+	}
+}
+
+func (c *LFUCache) freqList(freq int) *list.List {
+	l, ok := c.freqs[freq]
+	if !ok {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+func (c *LFUCache) remove(elem *list.Element) {
+	e := elem.Value.(*lfuEntry)
+	c.unlink(elem)
+	delete(c.cache, e.key)
+	c.length -= entrySize(e.key, e.value)
+	if e.freq == 1 {
+		c.coldLength -= entrySize(e.key, e.value)
+	}
+	if c.onEvicted != nil {
+		c.onEvicted(e.key, e.value)
+	}
+}
+
+// removeLeastFrequent 淘汰访问次数最少且最久未使用的数据
+func (c *LFUCache) removeLeastFrequent() {
+	if len(c.cache) == 0 {
+		return
+	}
+	l, ok := c.freqs[c.minFreq]
+	if !ok {
+		// 删除数据后minFreq可能失效,重新计算
+		c.minFreq = 0
+		for freq := range c.freqs {
+			if c.minFreq == 0 || freq < c.minFreq {
+				c.minFreq = freq
+			}
+		}
+		l = c.freqs[c.minFreq]
+	}
+	c.remove(l.Back())
+}
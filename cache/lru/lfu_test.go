@@ -0,0 +1,31 @@
+package lru
+
+import "testing"
+
+func TestLFURemoveLeastFrequent(t *testing.T) {
+	// 每条数据占用4字节,最多保存3条
+	lfu := NewLFUCache(int64(12), nil)
+	lfu.Add("k1", String("v1"), 0)
+	lfu.Add("k2", String("v2"), 0)
+	lfu.Add("k3", String("v3"), 0)
+	lfu.Get("k1", 0)
+	lfu.Get("k1", 0)
+	lfu.Get("k3", 0)
+
+	lfu.Add("k4", String("v4"), 0)
+	if _, ok := lfu.Get("k2", 0); ok {
+		t.Fatalf("expect k2 to be evicted")
+	}
+	for _, key := range []string{"k1", "k3", "k4"} {
+		if _, ok := lfu.Get(key, 0); !ok {
+			t.Fatalf("expect %s in cache", key)
+		}
+	}
+}
+
+func TestLFUTooLarge(t *testing.T) {
+	lfu := NewLFUCache(int64(4), nil)
+	if lfu.Add("key", String("value"), 0) || lfu.Len() != 0 {
+		t.Fatalf("expect value larger than capacity to be rejected")
+	}
+}
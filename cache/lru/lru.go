@@ -106,7 +106,7 @@ func (c *Cache) Delete(key string) (Value, bool) {
 		c.linkList.Remove(elem)
 		kv := elem.Value.(*entry)
 		// 修改缓存大小
-		c.length -= int64(kv.value.Len())
+		c.length -= int64(kv.value.Len()) + int64(len(kv.key))
 		// 从哈希表中删除数据
 		delete(c.cache, kv.key)
 		if c.onEvicted != nil {
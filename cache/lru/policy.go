@@ -0,0 +1,152 @@
+package lru
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// Policy 是缓存淘汰策略的抽象,实现都不是并发安全的,需要调用者加锁.
+// t为访问时的时间戳,不依赖访问时间的策略可以忽略
+type Policy interface {
+	Add(key string, value Value, t int64) bool // 添加数据,无法加入缓存时返回false
+	Get(key string, t int64) (Value, bool)     // 获取数据
+	Peek(key string) (Value, bool)             // 获取数据,不影响淘汰顺序
+	Delete(key string) bool                    // 删除数据,会调用回调函数
+	Len() int                                  // 返回缓存中数据的数量
+	Usage() Usage                              // 返回热数据区和冷数据区的占用情况
+	// Range 从最久未使用的数据开始遍历缓存中的数据,hot表示数据是否在热数据区,
+	// fn返回false时停止遍历.遍历期间不能修改缓存
+	Range(fn func(key string, value Value, hot bool) bool)
+}
+
+// RegionRestorer 由冷热数据区不能通过Add和Get恢复的策略实现,
+// 用于从快照中恢复数据时将数据直接放入原来所在的区域
+type RegionRestorer interface {
+	Restore(key string, value Value, hot bool, t int64) bool
+}
+
+// Restore 将数据恢复到缓存中原来所在的区域.
+// 策略没有实现RegionRestorer时,热数据区的数据在加入后再访问一次
+func Restore(p Policy, key string, value Value, hot bool, t int64) bool {
+	if r, ok := p.(RegionRestorer); ok {
+		return r.Restore(key, value, hot, t)
+	}
+	if !p.Add(key, value, t) {
+		return false
+	}
+	if hot {
+		p.Get(key, t)
+	}
+	return true
+}
+
+// RegionPeeker 由有冷热数据区的策略实现,用于查询单个数据所在的区域
+type RegionPeeker interface {
+	PeekRegion(key string) (value Value, hot bool, ok bool)
+}
+
+// PeekRegion 获取数据以及数据是否在热数据区,不影响淘汰顺序,与Range返回的区域一致.
+// 策略没有实现RegionPeeker时数据都在冷数据区
+func PeekRegion(p Policy, key string) (Value, bool, bool) {
+	if r, ok := p.(RegionPeeker); ok {
+		return r.PeekRegion(key)
+	}
+	v, ok := p.Peek(key)
+	return v, false, ok
+}
+
+// rangeList 从链表尾向链表头遍历,fn返回false时停止并返回false
+func rangeList(l *list.List, fn func(elem *list.Element) bool) bool {
+	for elem := l.Back(); elem != nil; elem = elem.Prev() {
+		if !fn(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// Usage 是缓存的占用情况.
+// 热数据区保存被多次访问的数据,冷数据区保存新加入或访问较少的数据,
+// 不区分冷热数据的策略将所有数据计入冷数据区
+type Usage struct {
+	HeatBytes int64 // 热数据区占用的字节数
+	HeatItems int64 // 热数据区的数据数量
+	ColdBytes int64 // 冷数据区占用的字节数
+	ColdItems int64 // 冷数据区的数据数量
+}
+
+// NewPolicyFunc 根据缓存容量和淘汰数据时的回调函数创建淘汰策略
+type NewPolicyFunc func(capacity int64, onEvicted func(key string, value Value)) Policy
+
+// 内置的淘汰策略
+var policies = map[string]NewPolicyFunc{
+	"hc": func(capacity int64, onEvicted func(key string, value Value)) Policy {
+		return NewHCCache(capacity, onEvicted)
+	},
+	"lru": func(capacity int64, onEvicted func(key string, value Value)) Policy {
+		return NewLRUPolicy(capacity, onEvicted)
+	},
+	"lfu": func(capacity int64, onEvicted func(key string, value Value)) Policy {
+		return NewLFUCache(capacity, onEvicted)
+	},
+	"arc": func(capacity int64, onEvicted func(key string, value Value)) Policy {
+		return NewARCCache(capacity, onEvicted)
+	},
+	"wtinylfu": func(capacity int64, onEvicted func(key string, value Value)) Policy {
+		return NewTinyLFUCache(capacity, onEvicted)
+	},
+}
+
+// PolicyByName 根据名称返回内置的淘汰策略: hc, lru, lfu, arc, wtinylfu
+func PolicyByName(name string) (NewPolicyFunc, error) {
+	if p, ok := policies[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy: %s", name)
+}
+
+// lruPolicy 将Cache适配为Policy
+type lruPolicy struct {
+	*Cache
+}
+
+// NewLRUPolicy 创建基于Cache的LRU淘汰策略
+func NewLRUPolicy(capacity int64, onEvicted func(key string, value Value)) Policy {
+	return lruPolicy{NewCache(capacity, onEvicted)}
+}
+
+func (p lruPolicy) Add(key string, value Value, _ int64) bool {
+	return p.Cache.Add(key, value)
+}
+
+func (p lruPolicy) Get(key string, _ int64) (Value, bool) {
+	return p.Cache.Get(key)
+}
+
+func (p lruPolicy) Peek(key string) (Value, bool) {
+	if elem, ok := p.Cache.cache[key]; ok {
+		return elem.Value.(*entry).value, true
+	}
+	return nil, false
+}
+
+func (p lruPolicy) Usage() Usage {
+	return Usage{ColdBytes: p.Cache.length, ColdItems: int64(p.Cache.Len())}
+}
+
+func (p lruPolicy) Range(fn func(key string, value Value, hot bool) bool) {
+	rangeList(p.Cache.linkList, func(elem *list.Element) bool {
+		e := elem.Value.(*entry)
+		return fn(e.key, e.value, false)
+	})
+}
+
+func (p lruPolicy) Delete(key string) bool {
+	_, ok := p.Cache.Delete(key)
+	return ok
+}
+
+// entrySize 返回一条数据占用的字节数
+func entrySize(key string, value Value) int64 {
+	return int64(len(key) + value.Len())
+}
@@ -0,0 +1,193 @@
+package lru
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// 所有内置淘汰策略都需要满足的行为
+var policyNames = []string{"hc", "lru", "lfu", "arc", "wtinylfu"}
+
+func forEachPolicy(t *testing.T, fn func(t *testing.T, newPolicy NewPolicyFunc)) {
+	for _, name := range policyNames {
+		newPolicy, err := PolicyByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			fn(t, newPolicy)
+		})
+	}
+}
+
+func TestPolicyGet(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		p := newPolicy(int64(1000), nil)
+		p.Add("key1", String("1234"), 0)
+		if v, ok := p.Get("key1", 0); !ok || string(v.(String)) != "1234" {
+			t.Fatalf("cache hit key1=1234 failed")
+		}
+		if _, ok := p.Get("key2", 0); ok {
+			t.Fatalf("cache miss key2 failed")
+		}
+	})
+}
+
+func TestPolicyUpdate(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		p := newPolicy(int64(1000), nil)
+		p.Add("key", String("1"), 0)
+		p.Add("key", String("111"), 5000)
+		if v, ok := p.Get("key", 5000); !ok || string(v.(String)) != "111" {
+			t.Fatalf("expect key=111, but got %v", v)
+		}
+		if p.Len() != 1 {
+			t.Fatalf("expect 1 key, but got %d", p.Len())
+		}
+	})
+}
+
+func TestPolicyDelete(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		keys := make([]string, 0)
+		p := newPolicy(int64(1000), func(key string, value Value) {
+			keys = append(keys, key)
+		})
+		p.Add("key1", String("1234"), 0)
+		if !p.Delete("key1") || p.Delete("key1") {
+			t.Fatalf("delete key1 failed")
+		}
+		if _, ok := p.Get("key1", 0); ok || p.Len() != 0 {
+			t.Fatalf("key1 should be deleted")
+		}
+		if len(keys) != 1 || keys[0] != "key1" {
+			t.Fatalf("expect OnEvicted called with key1, but got %v", keys)
+		}
+	})
+}
+
+func TestPolicyEvict(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		evicted := make(map[string]bool)
+		p := newPolicy(int64(200), func(key string, value Value) {
+			evicted[key] = true
+		})
+
+		n := 100
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key%02d", i)
+			p.Add(key, String("value"), int64(i))
+			p.Get(key, int64(i))
+		}
+
+		if len(evicted) == 0 {
+			t.Fatalf("expect some keys to be evicted")
+		}
+		if p.Len()+len(evicted) != n {
+			t.Fatalf("expect %d keys in total, but got %d cached and %d evicted", n, p.Len(), len(evicted))
+		}
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key%02d", i)
+			if _, ok := p.Get(key, int64(n)); ok == evicted[key] {
+				t.Fatalf("key %s: cached=%v, evicted=%v", key, ok, evicted[key])
+			}
+		}
+	})
+}
+
+func TestPolicyByName(t *testing.T) {
+	if _, err := PolicyByName("unknown"); err == nil {
+		t.Fatalf("expect error for unknown policy")
+	}
+}
+
+func TestPolicyPeek(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		p := newPolicy(int64(1000), nil)
+		p.Add("key1", String("1234"), 0)
+		if v, ok := p.Peek("key1"); !ok || string(v.(String)) != "1234" {
+			t.Fatalf("peek key1=1234 failed")
+		}
+		if _, ok := p.Peek("key2"); ok {
+			t.Fatalf("peek key2 should fail")
+		}
+	})
+}
+
+func TestPolicyUsage(t *testing.T) {
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		p := newPolicy(int64(1000), nil)
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("key%d", i)
+			p.Add(key, String("value"), 0)
+			if i%2 == 0 {
+				p.Get(key, 0)
+				p.Get(key, 0)
+			}
+		}
+		p.Delete("key0")
+
+		u := p.Usage()
+		if u.HeatItems+u.ColdItems != int64(p.Len()) {
+			t.Fatalf("expect %d items, but got %+v", p.Len(), u)
+		}
+		if u.HeatBytes+u.ColdBytes < int64(p.Len()*len("key0value")) {
+			t.Fatalf("expect at least %d bytes, but got %+v", p.Len()*len("key0value"), u)
+		}
+	})
+}
+
+func TestPolicyRangeRestore(t *testing.T) {
+	type record struct {
+		key   string
+		value string
+		hot   bool
+	}
+	collect := func(p Policy) []record {
+		records := make([]record, 0)
+		p.Range(func(key string, value Value, hot bool) bool {
+			records = append(records, record{key, string(value.(String)), hot})
+			return true
+		})
+		return records
+	}
+	forEachPolicy(t, func(t *testing.T, newPolicy NewPolicyFunc) {
+		p := newPolicy(int64(1000), nil)
+		for i := 0; i < 10; i++ {
+			p.Add(fmt.Sprintf("key%d", i), String(fmt.Sprintf("value%d", i)), 0)
+		}
+		for i := 0; i < 10; i += 3 {
+			p.Get(fmt.Sprintf("key%d", i), 0)
+		}
+		records := collect(p)
+		if len(records) != p.Len() {
+			t.Fatalf("expect %d records, but got %d", p.Len(), len(records))
+		}
+
+		restored := newPolicy(int64(1000), nil)
+		for _, r := range records {
+			Restore(restored, r.key, String(r.value), r.hot, 0)
+		}
+		if got := collect(restored); !reflect.DeepEqual(got, records) {
+			t.Fatalf("expect restored records %v, but got %v", records, got)
+		}
+		if restored.Usage() != p.Usage() {
+			t.Fatalf("expect usage %+v, but got %+v", p.Usage(), restored.Usage())
+		}
+		for _, r := range records {
+			if v, hot, ok := PeekRegion(p, r.key); !ok || string(v.(String)) != r.value || hot != r.hot {
+				t.Fatalf("expect %+v, but peek region got %v %v %v", r, v, hot, ok)
+			}
+		}
+
+		n := 0
+		p.Range(func(key string, value Value, hot bool) bool {
+			n++
+			return n < 3
+		})
+		if n != 3 {
+			t.Fatalf("expect range stopped after 3 records, but got %d", n)
+		}
+	})
+}
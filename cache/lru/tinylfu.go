@@ -0,0 +1,348 @@
+package lru
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+const (
+	windowRatio    = 0.01 // 窗口区占总容量的比例
+	protectedRatio = 0.8  // 保护区占主缓存区的比例
+	sketchDepth    = 4    // count-min sketch的行数
+	// 估算sketch宽度时假设的平均数据大小
+	avgEntrySize = 64
+	// sketch的最小宽度,避免小容量缓存中哈希冲突过多
+	minSketchWidth = 1024
+)
+
+// 数据所在的区域
+const (
+	regionWindow = iota
+	regionProbation
+	regionProtected
+)
+
+// TinyLFUCache 是按字节计算容量的W-TinyLFU缓存.
+// 新数据先进入窗口区(LRU),被窗口区淘汰的数据需要与主缓存区试用区的淘汰候选比较访问频率,
+// 频率更高的数据才能进入主缓存区. 主缓存区为分段LRU,试用区中再次被访问的数据进入保护区
+type TinyLFUCache struct {
+	capacity     int64
+	windowCap    int64 // 窗口区容量
+	protectedCap int64 // 保护区容量
+	mainCap      int64 // 主缓存区容量
+	window       *tinyList
+	probation    *tinyList
+	protected    *tinyList
+	cache        map[string]*list.Element
+	sketch       *cmSketch
+	onEvicted    func(key string, value Value)
+}
+
+type tinyEntry struct {
+	key    string
+	value  Value
+	size   int64
+	region int
+}
+
+type tinyList struct {
+	ll   *list.List
+	size int64
+}
+
+func NewTinyLFUCache(capacity int64, onEvicted func(key string, value Value)) *TinyLFUCache {
+	windowCap := int64(float64(capacity) * windowRatio)
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := capacity - windowCap
+	return &TinyLFUCache{
+		capacity:     capacity,
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: int64(float64(mainCap) * protectedRatio),
+		window:       &tinyList{ll: list.New()},
+		probation:    &tinyList{ll: list.New()},
+		protected:    &tinyList{ll: list.New()},
+		cache:        make(map[string]*list.Element),
+		sketch:       newCMSketch(capacity / avgEntrySize),
+		onEvicted:    onEvicted,
+	}
+}
+
+func (c *TinyLFUCache) Add(key string, value Value, _ int64) bool {
+	size := entrySize(key, value)
+	if size > c.capacity {
+		// 单条数据超过缓存容量,无法加入缓存
+		return false
+	}
+	c.sketch.increment(key)
+
+	if elem, ok := c.cache[key]; ok {
+		e := elem.Value.(*tinyEntry)
+		c.list(e.region).size += size - e.size
+		e.value, e.size = value, size
+		c.access(elem)
+		c.evictMain()
+		c.evictWindow()
+		return true
+	}
+
+	e := &tinyEntry{key: key, value: value, size: size, region: regionWindow}
+	c.cache[key] = c.window.ll.PushFront(e)
+	c.window.size += size
+	c.evictWindow()
+	return true
+}
+
+func (c *TinyLFUCache) Get(key string, _ int64) (Value, bool) {
+	c.sketch.increment(key)
+	if elem, ok := c.cache[key]; ok {
+		c.access(elem)
+		return elem.Value.(*tinyEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *TinyLFUCache) Peek(key string) (Value, bool) {
+	if elem, ok := c.cache[key]; ok {
+		return elem.Value.(*tinyEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *TinyLFUCache) PeekRegion(key string) (Value, bool, bool) {
+	if elem, ok := c.cache[key]; ok {
+		e := elem.Value.(*tinyEntry)
+		return e.value, e.region == regionProtected, true
+	}
+	return nil, false, false
+}
+
+func (c *TinyLFUCache) Delete(key string) bool {
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem)
+	return true
+}
+
+func (c *TinyLFUCache) Len() int {
+	return len(c.cache)
+}
+
+// Usage 将保护区计入热数据区,窗口区和试用区计入冷数据区
+func (c *TinyLFUCache) Usage() Usage {
+	return Usage{
+		HeatBytes: c.protected.size,
+		HeatItems: int64(c.protected.ll.Len()),
+		ColdBytes: c.window.size + c.probation.size,
+		ColdItems: int64(c.window.ll.Len() + c.probation.ll.Len()),
+	}
+}
+
+// Range 依次遍历窗口区,试用区和保护区
+func (c *TinyLFUCache) Range(fn func(key string, value Value, hot bool) bool) {
+	for _, l := range []*tinyList{c.window, c.probation, c.protected} {
+		hot := l == c.protected
+		if !rangeList(l.ll, func(elem *list.Element) bool {
+			e := elem.Value.(*tinyEntry)
+			return fn(e.key, e.value, hot)
+		}) {
+			return
+		}
+	}
+}
+
+// Restore 将新数据直接放入主缓存区,热数据放入保护区,冷数据放入试用区,不经过准入判断
+func (c *TinyLFUCache) Restore(key string, value Value, hot bool, t int64) bool {
+	size := entrySize(key, value)
+	if _, ok := c.cache[key]; ok || size > c.mainCap {
+		return c.Add(key, value, t)
+	}
+	c.sketch.increment(key)
+
+	e := &tinyEntry{key: key, value: value, size: size, region: regionProbation}
+	elem := c.probation.ll.PushFront(e)
+	c.cache[key] = elem
+	c.probation.size += size
+	if hot {
+		c.access(elem)
+	}
+	c.evictMain()
+	return true
+}
+
+func (c *TinyLFUCache) list(region int) *tinyList {
+	switch region {
+	case regionWindow:
+		return c.window
+	case regionProbation:
+		return c.probation
+	default:
+		return c.protected
+	}
+}
+
+// access 处理一次命中: 试用区的数据晋升到保护区,其余数据移动到所在链表头
+func (c *TinyLFUCache) access(elem *list.Element) {
+	e := elem.Value.(*tinyEntry)
+	if e.region != regionProbation {
+		c.list(e.region).ll.MoveToFront(elem)
+		return
+	}
+
+	c.probation.ll.Remove(elem)
+	c.probation.size -= e.size
+	e.region = regionProtected
+	c.cache[e.key] = c.protected.ll.PushFront(e)
+	c.protected.size += e.size
+
+	// 保护区超出容量时,将最久未使用的数据降级到试用区
+	for c.protected.size > c.protectedCap && c.protected.ll.Len() > 1 {
+		back := c.protected.ll.Back()
+		d := back.Value.(*tinyEntry)
+		c.protected.ll.Remove(back)
+		c.protected.size -= d.size
+		d.region = regionProbation
+		c.cache[d.key] = c.probation.ll.PushFront(d)
+		c.probation.size += d.size
+	}
+}
+
+// evictWindow 将窗口区超出容量的数据移出,并决定其能否进入主缓存区
+func (c *TinyLFUCache) evictWindow() {
+	for c.window.size > c.windowCap {
+		back := c.window.ll.Back()
+		candidate := back.Value.(*tinyEntry)
+		c.window.ll.Remove(back)
+		c.window.size -= candidate.size
+
+		if c.admit(candidate) {
+			candidate.region = regionProbation
+			c.cache[candidate.key] = c.probation.ll.PushFront(candidate)
+			c.probation.size += candidate.size
+			c.evictMain()
+		} else {
+			delete(c.cache, candidate.key)
+			if c.onEvicted != nil {
+				c.onEvicted(candidate.key, candidate.value)
+			}
+		}
+	}
+}
+
+// admit 判断窗口区淘汰的候选数据能否进入主缓存区
+func (c *TinyLFUCache) admit(candidate *tinyEntry) bool {
+	if c.probation.size+c.protected.size+candidate.size <= c.mainCap {
+		return true
+	}
+	victim := c.victim()
+	if victim == nil {
+		return candidate.size <= c.mainCap
+	}
+	return c.sketch.estimate(candidate.key) > c.sketch.estimate(victim.Value.(*tinyEntry).key)
+}
+
+// victim 返回主缓存区的淘汰候选,优先从试用区淘汰
+func (c *TinyLFUCache) victim() *list.Element {
+	if back := c.probation.ll.Back(); back != nil {
+		return back
+	}
+	return c.protected.ll.Back()
+}
+
+// evictMain 淘汰主缓存区超出容量的数据
+func (c *TinyLFUCache) evictMain() {
+	for c.probation.size+c.protected.size > c.mainCap {
+		c.remove(c.victim())
+	}
+}
+
+func (c *TinyLFUCache) remove(elem *list.Element) {
+	e := elem.Value.(*tinyEntry)
+	l := c.list(e.region)
+	l.ll.Remove(elem)
+	l.size -= e.size
+	delete(c.cache, e.key)
+	if c.onEvicted != nil {
+		c.onEvicted(e.key, e.value)
+	}
+}
+
+// cmSketch 是4位计数器的count-min sketch,用于估算key的访问频率.
+// 计数总数达到阈值时所有计数器减半,使频率估计随时间衰减
+type cmSketch struct {
+	rows      [sketchDepth][]uint8
+	seeds     [sketchDepth]uint64
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch(width int64) *cmSketch {
+	w := uint64(minSketchWidth)
+	for int64(w) < width {
+		w <<= 1
+	}
+	s := &cmSketch{
+		mask:    w - 1,
+		resetAt: int(w) * 10,
+		seeds:   [sketchDepth]uint64{0x9e3779b97f4a7c15, 0xbf58476d1ce4e5b9, 0x94d049bb133111eb, 0x2545f4914f6cdd1d},
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// index 返回哈希值在第i行中的位置
+func (s *cmSketch) index(h uint64, i int) uint64 {
+	x := h ^ s.seeds[i]
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x & s.mask
+}
+
+func (s *cmSketch) increment(key string) {
+	h := hashKey(key)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(key string) uint8 {
+	h := hashKey(key)
+	var m uint8 = 15
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// reset 将所有计数器减半
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
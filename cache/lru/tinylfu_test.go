@@ -0,0 +1,27 @@
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTinyLFUAdmission(t *testing.T) {
+	// 每条数据占用4字节
+	c := NewTinyLFUCache(int64(400), nil)
+	for i := 0; i < 99; i++ {
+		key := fmt.Sprintf("h%d", i%10)
+		c.Add(key, String("vv"), 0)
+		c.Get(key, 0)
+	}
+
+	// 只访问一次的数据频率较低,不能挤掉主缓存区中的高频数据
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("s%03d", i), String("v"), 0)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("h%d", i)
+		if _, ok := c.Get(key, 0); !ok {
+			t.Fatalf("expect %s to stay in cache", key)
+		}
+	}
+}
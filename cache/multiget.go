@@ -0,0 +1,157 @@
+package mycache
+
+import (
+	"TDKCache/peers"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Result 是批量获取中单个key的结果
+type Result struct {
+	Key     string
+	Value   ByteView
+	TTL     time.Duration // 剩余存活时间,0表示永不过期
+	Version uint64        // 本节点缓存中的版本号,0表示值来自远程节点或热点缓存
+	Err     error
+
+	manifest bool // Value是大对象的分块清单,返回给调用方之前需要组装
+}
+
+// GetMulti 批量获取key,返回的结果与keys一一对应.
+// 未命中的key按照负责的节点分组,每个远程节点只发送一次批量请求,
+// 本节点负责的key通过Getter并行加载,相同key的加载请求会被合并
+func (g *Group) GetMulti(keys []string) []Result {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 与GetMulti相同,ctx会传递到远程节点和Getter
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) []Result {
+	results := make([]Result, len(keys))
+	if g.closed.Load() {
+		for i, key := range keys {
+			results[i] = Result{Key: key, Err: ErrGroupClosed}
+		}
+		return results
+	}
+	var local []int
+	remote := make(map[peers.PeerGetter][]int)
+	for i, key := range keys {
+		if key == "" {
+			results[i] = Result{Key: key, Err: fmt.Errorf("key is required")}
+			continue
+		}
+		if res, ok := g.lookupCache(key); ok {
+			results[i] = res
+			continue
+		}
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				remote[peer] = append(remote[peer], i)
+				continue
+			}
+		}
+		local = append(local, i)
+	}
+
+	var wg sync.WaitGroup
+	for peer, idx := range remote {
+		wg.Add(1)
+		go func(peer peers.PeerGetter, idx []int) {
+			defer wg.Done()
+			g.getMultiFromPeer(ctx, peer, keys, idx, results)
+		}(peer, idx)
+	}
+	g.loadMultiLocally(ctx, keys, local, results, &wg)
+	wg.Wait()
+
+	// 组装分块保存的大对象
+	for i := range results {
+		if res := &results[i]; res.Err == nil {
+			res.Value, res.Err = g.resolveChunks(ctx, *res)
+			res.manifest = false
+			if res.Err != nil {
+				res.TTL = 0
+			}
+		}
+	}
+	return results
+}
+
+// getMultiFromPeer 从远程节点批量获取keys中下标为idx的key,
+// 与load一致,远程节点获取失败的key从本地加载
+func (g *Group) getMultiFromPeer(ctx context.Context, peer peers.PeerGetter, keys []string, idx []int, results []Result) {
+	batch := make([]string, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+	}
+	res, err := peer.BatchGet(ctx, g.name, batch)
+	if err == nil && len(res) != len(batch) {
+		err = fmt.Errorf("peer returned %d results for %d keys", len(res), len(batch))
+	}
+	if err != nil {
+		g.stats.peerErrors.Add(1)
+		groupLogger.Info("failed to batch get from peer: %v", err)
+		if ctx.Err() != nil {
+			for _, i := range idx {
+				results[i] = Result{Key: keys[i], Err: ctx.Err()}
+			}
+			return
+		}
+		var wg sync.WaitGroup
+		g.loadMultiLocally(ctx, keys, idx, results, &wg)
+		wg.Wait()
+		return
+	}
+
+	var failed []int
+	for j, i := range idx {
+		r := res[j]
+		switch {
+		case r.Err == nil:
+			g.stats.peerLoads.Add(1)
+			value := ByteView{data: r.Value}
+			g.populateHotCache(keys[i], value, r.TTL)
+			results[i] = Result{Key: keys[i], Value: value, TTL: r.TTL}
+		case IsNotFound(r.Err):
+			g.stats.peerLoads.Add(1)
+			results[i] = Result{Key: keys[i], Err: r.Err}
+		default:
+			g.stats.peerErrors.Add(1)
+			groupLogger.Info("failed to get key [%s] from peer: %v", keys[i], r.Err)
+			failed = append(failed, i)
+		}
+	}
+	var wg sync.WaitGroup
+	g.loadMultiLocally(ctx, keys, failed, results, &wg)
+	wg.Wait()
+}
+
+// loadMultiLocally 通过Getter并行加载keys中下标为idx的key,调用方需要等待wg
+func (g *Group) loadMultiLocally(ctx context.Context, keys []string, idx []int, results []Result, wg *sync.WaitGroup) {
+	for _, i := range idx {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = g.loadLocally(ctx, keys[i])
+		}(i)
+	}
+}
+
+// loadLocally 通过Getter加载key,与其他相同key的加载请求合并
+func (g *Group) loadLocally(ctx context.Context, key string) Result {
+	executed := false
+	v, err := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		executed = true
+		return g.getLocally(ctx, key)
+	})
+	if !executed {
+		g.stats.dedupedLoads.Add(1)
+	}
+	if err != nil {
+		return Result{Key: key, Err: err}
+	}
+	res := v.(loadResult)
+	return Result{Key: key, Value: res.value, TTL: res.ttl, Version: res.version}
+}
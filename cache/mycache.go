@@ -4,16 +4,35 @@ import (
 	"TDKCache/cache/singleflight"
 	"TDKCache/peers"
 	"TDKCache/service/log"
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Group struct {
-	name      string              // group名
-	getter    Getter              // 缓存未命中时的回调函数
-	mainCache *cache              // LRU缓存
-	peers     peers.PeerPicker    // 远程节点选择表
-	loader    *singleflight.Group // 控制远程请求
+	name         string              // group名
+	getter       Getter              // 缓存未命中时的回调函数
+	mainCache    *cache              // LRU缓存
+	hotCache     *cache              // 从远程节点加载的热点数据,可能为nil
+	hotTTL       time.Duration       // 热点缓存的存活时间
+	hotAdmission HotAdmission        // 热点缓存的准入策略
+	peers        peers.PeerPicker    // 远程节点选择表
+	loader       *singleflight.Group // 控制远程请求
+	stats        groupStats          // 统计数据
+	refreshing   sync.Map            // 正在后台刷新的key
+	aof          *appendLog          // 追加日志,可能为nil
+	chunkSize    int64               // 超过该大小的值被切分为多个分块保存
+	codec        Codec               // 压缩算法,为nil时不压缩
+	// 超过该大小的值在写入缓存前压缩
+	compressThreshold int
+
+	closed    atomic.Bool   // 是否已经关闭
+	closeOnce sync.Once     // 保证只关闭一次
+	stop      chan struct{} // 关闭时通知后台goroutine退出
 }
 
 type Getter interface {
@@ -26,26 +45,100 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// GetterWithTTL 在返回数据的同时返回该key的存活时间,
+// 存活时间小于等于0时使用默认的过期时间
+type GetterWithTTL interface {
+	Getter
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+type GetterWithTTLFunc func(key string) ([]byte, time.Duration, error)
+
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
+func (f GetterWithTTLFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// GetterWithContext 在加载数据时接收调用方的ctx,ctx结束时应当尽快返回.
+// 返回的存活时间小于等于0时使用默认的过期时间
+type GetterWithContext interface {
+	Getter
+	GetWithContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+type GetterWithContextFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f GetterWithContextFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(context.Background(), key)
+	return bytes, err
+}
+
+func (f GetterWithContextFunc) GetWithContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
 var (
 	mu          sync.RWMutex // 读写锁
 	groups      = make(map[string]*Group)
 	groupLogger = log.NewLogger("Cache", "Group")
 )
 
-func NewGroup(name string, capacity int64, getter Getter) *Group {
+var (
+	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupNotFound = errors.New("no such group")
+	ErrGroupClosed   = errors.New("group closed")
+)
+
+// NewGroup 创建并注册group,已经存在同名的group时返回ErrGroupExists
+func NewGroup(name string, capacity int64, getter Getter, opts ...Option) (*Group, error) {
 	if getter == nil {
 		groupLogger.Panic("Getter can't be nil\n")
 	}
 	mu.Lock()
 	defer mu.Unlock()
+	if _, ok := groups[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, name)
+	}
+	o := applyOptions(opts)
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: NewCache(capacity, nil),
-		loader:    &singleflight.Group{},
+		name:         name,
+		getter:       getter,
+		loader:       &singleflight.Group{},
+		hotTTL:       o.hotTTL,
+		hotAdmission: o.hotAdmission,
+		codec:        o.codec,
+		stop:         make(chan struct{}),
+
+		compressThreshold: o.compressThreshold,
+	}
+	var records []aofRecord
+	if o.aofDir != "" {
+		var err error
+		if g.aof, records, err = openAppendLog(aofPath(o.aofDir, name), o.fsync); err != nil {
+			return nil, fmt.Errorf("open append log of group [%s]: %w", name, err)
+		}
+	}
+	g.hotCache = newHotCache(o)
+	g.mainCache = NewCache(capacity, g.recordEviction, opts...)
+	g.mainCache.setManifestCallback(g.dropChunks)
+	if g.chunkSize = o.chunkSize; g.chunkSize <= 0 {
+		g.chunkSize = capacity / int64(len(g.mainCache.shards)) / defaultChunkRatio
+		if g.chunkSize < 1 {
+			g.chunkSize = 1
+		}
+	}
+	if g.aof != nil {
+		n := g.replayLog(records)
+		groupLogger.Info("restored %d keys of group [%s] from append log", n, name)
+		g.mainCache.setJournal(g.logAppend)
+		go g.runAppendLog(o.compactSize)
 	}
 	groups[name] = g
-	return g
+	return g, nil
 }
 
 func GetGroup(name string) *Group {
@@ -55,35 +148,318 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// ListGroups 返回所有group的名字,按照名字排序
+func ListGroups() []string {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// DestroyGroup 关闭并注销名为name的group,group不存在时返回ErrGroupNotFound
+func DestroyGroup(name string) error {
+	g := GetGroup(name)
+	if g == nil {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	return g.Close()
+}
+
+// CloseGroups 关闭所有group,用于进程退出前同步并关闭追加日志
+func CloseGroups() error {
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+
+	var errs []error
+	for _, g := range all {
+		if err := g.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("group %s: %w", g.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Name 返回group的名字
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Close 注销group,停止后台的过期检查和日志同步,关闭追加日志并释放缓存的数据.
+// 关闭后可以创建同名的group,开启追加日志时新的group会从日志恢复数据.
+// 关闭后的读写返回ErrGroupClosed,多次调用Close是安全的
+func (g *Group) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		mu.Lock()
+		if groups[g.name] == g {
+			delete(groups, g.name)
+		}
+		mu.Unlock()
+
+		g.closed.Store(true)
+		close(g.stop)
+		g.mainCache.close()
+		if g.hotCache != nil {
+			g.hotCache.close()
+		}
+		if g.aof != nil {
+			err = g.aof.close()
+		}
+		groupLogger.Info("group [%s] closed", g.name)
+	})
+	return err
+}
+
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与Get相同,ctx会传递到远程节点和Getter,ctx结束时立即返回
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	view, _, err := g.GetWithTTLContext(ctx, key)
+	return view, err
+}
+
+// GetWithTTL 返回key对应的值以及剩余存活时间,剩余存活时间为0表示永不过期
+func (g *Group) GetWithTTL(key string) (ByteView, time.Duration, error) {
+	return g.GetWithTTLContext(context.Background(), key)
+}
+
+// GetWithTTLContext 与GetWithTTL相同,ctx会传递到远程节点和Getter,ctx结束时立即返回
+func (g *Group) GetWithTTLContext(ctx context.Context, key string) (ByteView, time.Duration, error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, 0, fmt.Errorf("key is required")
+	}
+	if g.closed.Load() {
+		return ByteView{}, 0, ErrGroupClosed
+	}
+
+	res, ok := g.lookupCache(key)
+	if !ok {
+		res = g.loadResult(ctx, key)
+	}
+	if res.Err != nil {
+		return ByteView{}, 0, res.Err
+	}
+	view, err := g.resolveChunks(ctx, res)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	return view, res.TTL, nil
+}
+
+// lookupCache 在主缓存和热点缓存中查找key,未命中时ok为false
+func (g *Group) lookupCache(key string) (res Result, ok bool) {
+	return g.lookup(key, true)
+}
+
+// lookup 在主缓存中查找key,useHot为true时同时查找热点缓存,未命中时ok为false
+func (g *Group) lookup(key string, useHot bool) (res Result, ok bool) {
+	g.stats.gets.Add(1)
+	if it, ttl, ok := g.mainCache.get(key); ok {
+		g.stats.hits.Add(1)
+		if it.notFound {
+			g.stats.negativeHits.Add(1)
+			groupLogger.Debug("key [%s] hit negative cache\n", key)
+			return Result{Key: key, Err: &NotFoundError{Key: key}}, true
+		}
+		groupLogger.Debug("key [%s] hit\n", key)
+		if g.mainCache.needRefresh(it) {
+			g.refresh(key)
+		}
+		view, err := g.decompress(g.mainCache, key, it)
+		return Result{Key: key, Value: view, TTL: ttl, Version: it.version, Err: err, manifest: it.manifest}, true
 	}
+	if useHot && g.hotCache != nil {
+		if it, ttl, ok := g.hotCache.get(key); ok {
+			g.stats.hotHits.Add(1)
+			groupLogger.Debug("key [%s] hit hot cache\n", key)
+			view, err := g.decompress(g.hotCache, key, it)
+			return Result{Key: key, Value: view, TTL: ttl, Err: err}, true
+		}
+	}
+	g.stats.misses.Add(1)
+	groupLogger.Debug("key [%s] miss\n", key)
+	return Result{}, false
+}
 
-	if v, ok := g.mainCache.get(key); ok {
-		groupLogger.Info("key [%s] hit: %v\n", key, v)
-		return v, nil
+// decompress 解压缓存中的值,每次读取只解压一次.
+// 无法解压的值会从缓存中删除,下一次读取重新加载
+func (g *Group) decompress(c *cache, key string, it *item) (ByteView, error) {
+	view, err := it.view.decompress()
+	if err != nil {
+		groupLogger.Error("drop key [%s]: %v", key, err)
+		c.deleteIf(key, func(cur *item) bool { return cur == it })
+		return ByteView{}, fmt.Errorf("key [%s]: %w", key, err)
 	}
-	groupLogger.Info("key [%s] miss\n", key)
-	return g.load(key)
+	return view, nil
 }
 
+// Set 将key写入负责该key的节点,使用默认的过期时间
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetWithTTLContext(context.Background(), key, value, 0)
+}
+
+// SetWithTTL 将key写入负责该key的节点,并在ttl后过期,ttl小于等于0时使用默认的过期时间
+func (g *Group) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return g.SetWithTTLContext(context.Background(), key, value, ttl)
+}
+
+// SetWithTTLContext 与SetWithTTL相同,ctx会传递到远程节点.
+// 超过分块大小的值被切分后分别写入负责各分块的节点,原key只保存分块清单
+func (g *Group) SetWithTTLContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return g.SetWithTagsContext(ctx, key, value, ttl, nil)
+}
+
+// SetWithTagsContext 与SetWithTTLContext相同,同时记录key的标签.
+// 大对象的标签只记录在分块清单上,分块在清单被覆盖或删除后由负责该key的节点删除
+func (g *Group) SetWithTagsContext(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if g.closed.Load() {
+		return ErrGroupClosed
+	}
+
+	if int64(len(value)) > g.chunkSize {
+		manifest, err := g.storeChunks(ctx, key, value, ttl)
+		if err != nil {
+			groupLogger.Info("failed to set key [%s]: %v", key, err)
+			return err
+		}
+		if err = g.setValue(ctx, key, manifest, ttl, tags, true); err != nil {
+			// 清单没有写入,已经写入的分块不会被引用
+			g.dropChunks(key, manifest)
+		}
+		return err
+	}
+	return g.setValue(ctx, key, value, ttl, tags, false)
+}
+
+// setValue 将value写入负责key的节点,manifest表示value是分块清单
+func (g *Group) setValue(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string, manifest bool) error {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			// 本地的热点副本已经过时,其他节点的热点副本在过期后更新
+			g.removeHot(key)
+			var err error
+			if manifest {
+				err = peer.SetManifest(ctx, g.name, key, value, ttl, tags)
+			} else {
+				err = peer.SetWithTags(ctx, g.name, key, value, ttl, tags)
+			}
+			if err != nil {
+				groupLogger.Info("failed to set key [%s] to peer: %v", key, err)
+				return err
+			}
+			return nil
+		}
+	}
+	if manifest {
+		return g.SetManifestLocally(key, value, ttl, tags)
+	}
+	return g.SetLocallyWithTags(key, value, ttl, tags)
+}
+
+// SetLocally 将key写入本地缓存,不经过远程节点,用于处理其他节点转发的写请求.
+// value不会被切分,转发的大对象已经由发起写入的节点切分,分块也通过这里写入
+func (g *Group) SetLocally(key string, value []byte, ttl time.Duration) error {
+	return g.SetLocallyWithTags(key, value, ttl, nil)
+}
+
+// Delete 删除负责该key的节点以及本地的key,其他节点的热点副本在过期后失效
 func (g *Group) Delete(key string) error {
+	return g.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext 与Delete相同,ctx会传递到远程节点
+func (g *Group) DeleteContext(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return g.deleteValue(ctx, key)
+}
+
+// deleteValue 删除负责key的节点以及本地的key,不检查key,用于删除分块
+func (g *Group) deleteValue(ctx context.Context, key string) error {
+	if err := g.DeleteLocally(key); err != nil {
+		return err
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if err := peer.Delete(ctx, g.name, key); err != nil {
+				groupLogger.Info("failed to delete key [%s] from peer: %v", key, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteEverywhere 删除所有节点中的key,包括各节点的热点副本
+func (g *Group) DeleteEverywhere(key string) error {
+	return g.DeleteEverywhereContext(context.Background(), key)
+}
+
+// DeleteEverywhereContext 与DeleteEverywhere相同,ctx会传递到远程节点
+func (g *Group) DeleteEverywhereContext(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if err := g.DeleteLocally(key); err != nil {
+		return err
+	}
+	if g.peers == nil {
+		return nil
+	}
+	all := g.peers.AllPeers()
+	errs := make([]error, len(all))
+	var wg sync.WaitGroup
+	for i, peer := range all {
+		wg.Add(1)
+		go func(i int, peer peers.PeerGetter) {
+			defer wg.Done()
+			errs[i] = peer.Delete(ctx, g.name, key)
+		}(i, peer)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		groupLogger.Info("failed to delete key [%s] from peers: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteLocally 删除本地缓存和热点缓存中的key,不经过远程节点,用于处理其他节点转发的删除请求,
+// 分块也通过这里删除
+func (g *Group) DeleteLocally(key string) error {
 	if key == "" {
 		return fmt.Errorf("key is required")
 	}
+	if g.closed.Load() {
+		return ErrGroupClosed
+	}
 
 	g.mainCache.delete(key)
+	g.removeHot(key)
 	return nil
-
 }
 
-func (g *Group) getFromPeer(peer peers.PeerGetter, key string) (ByteView, error) {
-	if bytes, err := peer.Get(g.name, key); err != nil {
+func (g *Group) getFromPeer(ctx context.Context, peer peers.PeerGetter, key string) (ByteView, time.Duration, error) {
+	if bytes, ttl, err := peer.Get(ctx, g.name, key); err != nil {
 		groupLogger.Info("failed to get key [%s] from peer", key)
-		return ByteView{}, err
+		return ByteView{}, 0, err
 	} else {
-		return ByteView{data: bytes}, nil
+		return ByteView{data: bytes}, ttl, nil
 	}
 }
 
@@ -101,42 +477,146 @@ func (g *Group) getFromPeer(peer peers.PeerGetter, key string) (ByteView, error)
 		return ByteView{data: res.Value}, nil
 	}
 */
-func (g *Group) load(key string) (value ByteView, err error) {
+// loadResult 加载key并转换为Result
+func (g *Group) loadResult(ctx context.Context, key string) Result {
+	res, err := g.load(ctx, key)
+	if err != nil {
+		return Result{Key: key, Err: err}
+	}
+	return Result{Key: key, Value: res.value, TTL: res.ttl, Version: res.version}
+}
+
+func (g *Group) load(ctx context.Context, key string) (loadResult, error) {
 	// 当key不在缓存时,从远程或本地获取需要缓存的值
 	// 从远程获取,使用loader避免缓存击穿
 	// 讲原流程包装为fn函数传入Do方法中
-	retValue, err := g.loader.Do(key, func() (interface{}, error) {
+	executed := false
+	retValue, err := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		executed = true
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+				value, ttl, err := g.getFromPeer(ctx, peer, key)
+				if err == nil {
+					g.stats.peerLoads.Add(1)
+					g.populateHotCache(key, value, ttl)
+					return loadResult{value: value, ttl: ttl}, nil
+				} else if IsNotFound(err) {
+					// 远程节点已确认key不存在,不再从本地加载
+					g.stats.peerLoads.Add(1)
+					return nil, err
 				}
+				g.stats.peerErrors.Add(1)
 				groupLogger.Info("failed to get from peer: %v", err)
+				if ctx.Err() != nil {
+					// 调用方已经放弃,不再从本地加载
+					return nil, ctx.Err()
+				}
 			}
 		}
 		// 先从本地获取缓存
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
-	if err == nil {
-		return retValue.(ByteView), nil
+	if !executed {
+		// 与正在进行的相同请求合并
+		g.stats.dedupedLoads.Add(1)
 	}
-	return
+	if err != nil {
+		return loadResult{}, err
+	}
+	return retValue.(loadResult), nil
+}
 
+// loadResult 是一次加载得到的值及其存活时间
+type loadResult struct {
+	value   ByteView
+	ttl     time.Duration
+	version uint64 // 写入本地缓存时分配的版本号,从远程节点加载时为0
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
+func (g *Group) getLocally(ctx context.Context, key string) (loadResult, error) {
+	if isChunkKey(key) {
+		// 分块只能通过写入大对象产生,缺失时不应该访问数据源
+		return loadResult{}, &NotFoundError{Key: key}
+	}
 	groupLogger.Info("get key [%s] locally\n", key)
-	bytes, err := g.getter.Get(key)
+	start := time.Now()
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	switch getter := g.getter.(type) {
+	case GetterWithContext:
+		bytes, ttl, err = getter.GetWithContext(ctx, key)
+	case GetterWithTTL:
+		bytes, ttl, err = getter.GetWithTTL(key)
+	default:
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
-		return ByteView{}, err
+		if IsNotFound(err) {
+			// 缓存不存在的key,避免请求反复穿透到数据源
+			g.stats.localLoads.Add(1)
+			g.mainCache.addNotFound(key)
+			return loadResult{}, &NotFoundError{Key: key}
+		}
+		g.stats.localLoadErrs.Add(1)
+		return loadResult{}, err
+	}
+	g.stats.localLoads.Add(1)
+	if ttl <= 0 {
+		ttl = expireTime
 	}
 	value := ByteView{data: cloneBytes(bytes)}
-	g.populateCache(key, value)
-	return value, nil
+	stored, manifest := g.compress(value), false
+	if int64(value.Len()) > g.chunkSize {
+		// 大对象切分后保存,本次请求直接返回完整的值
+		data, err := g.storeChunks(ctx, key, value.data, ttl)
+		if err != nil {
+			groupLogger.Info("failed to cache key [%s]: %v", key, err)
+			return loadResult{value: value, ttl: ttl}, nil
+		}
+		stored, manifest = ByteView{data: data}, true
+	}
+	it := &item{view: stored, delta: time.Since(start), manifest: manifest}
+	g.mainCache.update(key, func(old *item) (*item, time.Duration, error) {
+		// 提前刷新时保留原来的标签
+		if old != nil {
+			it.tags = old.tags
+		}
+		return it, ttl, nil
+	})
+	return loadResult{value: value, ttl: ttl, version: it.version}, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// refresh 在后台重新加载本节点负责的key,加载完成前访问该key仍然返回旧值.
+// 与普通的加载共用singleflight,同一时间每个key最多只有一个加载请求.
+// 刷新不受触发刷新的请求的ctx影响
+func (g *Group) refresh(key string) {
+	if isChunkKey(key) || g.closed.Load() {
+		return
+	}
+	if g.peers != nil {
+		if _, ok := g.peers.PickPeer(key); ok {
+			return
+		}
+	}
+	if _, loading := g.refreshing.LoadOrStore(key, struct{}{}); loading {
+		return
+	}
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer g.refreshing.Delete(key)
+		ctx := context.Background()
+		_, err := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+			return g.getLocally(ctx, key)
+		})
+		if err != nil && !IsNotFound(err) {
+			// 刷新失败时保留旧值,直到其过期
+			g.stats.refreshErrs.Add(1)
+			groupLogger.Info("failed to refresh key [%s]: %v", key, err)
+		}
+	}()
 }
 
 // RegisterPeers向Group注册 PeerPicker
@@ -0,0 +1,214 @@
+package mycache
+
+import (
+	"TDKCache/cache/lru"
+	"TDKCache/cache/timingwheel"
+	"TDKCache/service/conf"
+	"time"
+)
+
+const defaultPolicy = "hc"
+
+// Option 用于在创建Group或cache时修改默认配置
+type Option func(*options)
+
+type options struct {
+	clock       timingwheel.Clock  // 判断过期使用的时钟
+	newPolicy   lru.NewPolicyFunc  // 创建淘汰策略的函数
+	shards      int                // 期望的分片数量
+	mode        ExpirationMode     // 过期模式
+	maxAge      time.Duration      // 写入后的最长存活时间
+	callbacks   []EvictionCallback // 数据被移出缓存时的回调函数
+	negativeTTL time.Duration      // 负缓存的存活时间
+	refreshAt   float64            // 数据存活超过该比例的ttl后提前刷新
+	refreshBeta float64            // 概率提前刷新的系数
+
+	hotCapacity  int64         // 热点缓存容量,小于等于0时不使用热点缓存
+	hotTTL       time.Duration // 热点缓存的存活时间
+	hotAdmission HotAdmission  // 热点缓存的准入策略
+
+	aofDir      string      // 追加日志目录,为空时不记录日志
+	fsync       FsyncPolicy // 追加日志的同步策略
+	compactSize int64       // 触发追加日志压缩的最小大小
+
+	chunkSize int64 // 大对象的分块大小,小于等于0时为每个分片容量的1/4
+
+	codec             Codec // 压缩算法,为nil时不压缩
+	compressThreshold int   // 超过该大小的值在写入缓存前压缩
+}
+
+func defaultOptions() options {
+	return options{
+		clock:       timingwheel.RealClock,
+		newPolicy:   confPolicy(),
+		shards:      confInt("cache.shards", defaultShards),
+		negativeTTL: confDuration("cache.negativeExpireTime", defaultNegativeExpireTime, time.Second),
+		refreshAt:   conf.Conf.GetFloat64("cache.refreshAhead"),
+		refreshBeta: conf.Conf.GetFloat64("cache.refreshBeta"),
+
+		hotCapacity:  conf.Conf.GetInt64("cache.hotCapacity") << 10,
+		hotTTL:       confDuration("cache.hotExpireTime", defaultHotExpireTime, time.Second),
+		hotAdmission: SampleAdmission(confInt("cache.hotSampleRate", defaultHotSampleRate)),
+
+		aofDir:      conf.Conf.GetString("aof.dir"),
+		fsync:       confFsyncPolicy(),
+		compactSize: int64(confInt("aof.compactSize", defaultCompactSize)) << 20,
+
+		chunkSize: conf.Conf.GetInt64("cache.chunkSize") << 10,
+
+		codec:             confCodec(),
+		compressThreshold: confInt("cache.compressThreshold", defaultCompressThreshold),
+	}
+}
+
+// confCodec 返回配置文件中cache.compression指定的压缩算法,未配置时不压缩
+func confCodec() Codec {
+	name := conf.Conf.GetString("cache.compression")
+	if name == "" {
+		return nil
+	}
+	codec, err := CodecByName(name)
+	if err != nil {
+		cacheLogger.Panic("%v", err)
+	}
+	return codec
+}
+
+// confFsyncPolicy 返回配置文件中aof.fsync指定的同步策略,未配置时每秒同步一次
+func confFsyncPolicy() FsyncPolicy {
+	policy, err := ParseFsyncPolicy(conf.Conf.GetString("aof.fsync"))
+	if err != nil {
+		cacheLogger.Panic("%v", err)
+	}
+	return policy
+}
+
+// confPolicy 返回配置文件中cache.policy指定的淘汰策略,未配置时使用HCCache
+func confPolicy() lru.NewPolicyFunc {
+	name := conf.Conf.GetString("cache.policy")
+	if name == "" {
+		name = defaultPolicy
+	}
+	newPolicy, err := lru.PolicyByName(name)
+	if err != nil {
+		cacheLogger.Panic("%v", err)
+	}
+	return newPolicy
+}
+
+func applyOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithClock 设置判断过期使用的时钟,测试时可以传入timingwheel.FakeClock手动推进时间
+func WithClock(clock timingwheel.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithPolicy 设置缓存的淘汰策略,可以使用lru.PolicyByName获取内置的策略
+func WithPolicy(newPolicy lru.NewPolicyFunc) Option {
+	return func(o *options) {
+		o.newPolicy = newPolicy
+	}
+}
+
+// WithShards 设置缓存的分片数量,实际数量会向下取整为2的幂,
+// 并保证每个分片的容量不小于1KB
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// WithExpiration 设置过期模式,默认为SlidingExpiration.
+// maxAge只在SlidingExpirationWithMaxAge模式下生效,表示写入后的最长存活时间
+func WithExpiration(mode ExpirationMode, maxAge time.Duration) Option {
+	return func(o *options) {
+		o.mode = mode
+		o.maxAge = maxAge
+	}
+}
+
+// WithEvictionCallback 添加数据被移出缓存时的回调函数,回调函数会收到key,值以及移出的原因.
+// 回调函数在释放缓存的锁之后调用,可以安全地访问缓存.压缩的值解压后传给回调函数,无法解压时值为空
+func WithEvictionCallback(fn EvictionCallback) Option {
+	return func(o *options) {
+		o.callbacks = append(o.callbacks, fn)
+	}
+}
+
+// WithNegativeTTL 设置负缓存的存活时间,Getter返回NotFoundError后,
+// 在该时间内对同一key的请求直接返回NotFoundError
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithRefreshAhead 设置提前刷新的时机,数据写入后经过fraction*ttl时,
+// 下一次访问会在后台重新加载数据,加载完成前仍然返回旧值.fraction小于等于0时关闭
+func WithRefreshAhead(fraction float64) Option {
+	return func(o *options) {
+		o.refreshAt = fraction
+	}
+}
+
+// WithEarlyRefresh 开启XFetch方式的概率提前刷新,越接近过期,加载越慢,提前刷新的概率越大,
+// 避免大量key同时过期时请求集中到数据源.beta越大刷新越早,通常取1,小于等于0时关闭
+func WithEarlyRefresh(beta float64) Option {
+	return func(o *options) {
+		o.refreshBeta = beta
+	}
+}
+
+// WithHotCache 设置热点缓存的容量和存活时间,热点缓存保存从远程节点加载的数据.
+// 默认不使用热点缓存,capacity小于等于0时关闭热点缓存,ttl小于等于0时使用默认值
+func WithHotCache(capacity int64, ttl time.Duration) Option {
+	return func(o *options) {
+		o.hotCapacity = capacity
+		if ttl > 0 {
+			o.hotTTL = ttl
+		}
+	}
+}
+
+// WithHotAdmission 设置热点缓存的准入策略,默认使用SampleAdmission
+func WithHotAdmission(admission HotAdmission) Option {
+	return func(o *options) {
+		o.hotAdmission = admission
+	}
+}
+
+// WithAppendLog 开启追加日志,group的写入,删除和过期会记录到dir下以group名命名的文件中,
+// 创建group时重放日志恢复数据.通过Getter加载的数据不会记录,只在压缩日志时写入
+func WithAppendLog(dir string, policy FsyncPolicy) Option {
+	return func(o *options) {
+		o.aofDir = dir
+		o.fsync = policy
+	}
+}
+
+// WithChunkSize 设置大对象的分块大小,超过size的值被切分为多个分块,
+// 分块以派生的key保存,可能分布在不同的节点上.size小于等于0时为每个分片容量的1/4
+func WithChunkSize(size int64) Option {
+	return func(o *options) {
+		o.chunkSize = size
+	}
+}
+
+// WithCompression 设置值的压缩算法,超过threshold字节的值在写入缓存前压缩,
+// 缓存容量按照压缩后的大小计算,读取时才解压.codec为nil时关闭压缩,threshold小于等于0时使用默认值
+func WithCompression(codec Codec, threshold int) Option {
+	return func(o *options) {
+		o.codec = codec
+		if threshold > 0 {
+			o.compressThreshold = threshold
+		}
+	}
+}
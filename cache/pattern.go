@@ -0,0 +1,170 @@
+package mycache
+
+import (
+	"TDKCache/cache/lru"
+	"TDKCache/peers"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidPattern 表示DeletePattern的glob模式格式错误
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+// compileGlob 将glob模式转换为正则表达式.
+// 支持 * (任意字符串), ? (任意单个字符), [abc] [a-z] [!a] [^a] (字符集合) 以及 \ 转义.
+// 与path.Match不同,*可以匹配包括/在内的任意字符
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			if i++; i == len(pattern) {
+				return nil, fmt.Errorf("%w: trailing backslash in [%s]", ErrInvalidPattern, pattern)
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed [ in [%s]", ErrInvalidPattern, pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString(`)$`)
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPattern, err)
+	}
+	return re, nil
+}
+
+// escapeGlob 转义s中的glob特殊字符,使其只匹配s本身
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// deleteMatch 删除分片中满足match的key,返回删除的key以及其中未过期的数据的数量.
+// 分块不直接匹配,随清单一起删除.负缓存和已经过期的数据会被删除但不计数
+func (s *cacheShard) deleteMatch(match func(key string) bool) (keys []string, n int) {
+	s.lck.Lock()
+	defer s.unlock()
+	now := s.clock.Now()
+	s.lru.Range(func(key string, value lru.Value, hot bool) bool {
+		if isChunkKey(key) || !match(key) {
+			return true
+		}
+		keys = append(keys, key)
+		if !value.(*item).notFound && !s.exMap.expired(key, now) {
+			n++
+		}
+		return true
+	})
+	// 遍历期间不能修改淘汰策略,遍历结束后再删除
+	for _, key := range keys {
+		s.remove(key, EvictDeleted)
+		s.logLocked(aofRecord{op: opDelete, key: key})
+	}
+	return keys, n
+}
+
+// DeletePrefix 删除所有节点中以prefix开头的key,返回删除的key数量
+func (g *Group) DeletePrefix(prefix string) (int, error) {
+	return g.DeletePrefixContext(context.Background(), prefix)
+}
+
+// DeletePrefixContext 与DeletePrefix相同,ctx会传递到远程节点.prefix不能为空,删除所有key需要使用模式*
+func (g *Group) DeletePrefixContext(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, fmt.Errorf("prefix is required")
+	}
+	return g.DeletePatternContext(ctx, escapeGlob(prefix)+"*")
+}
+
+// DeletePattern 删除所有节点中匹配glob模式的key,包括各节点的热点副本,返回删除的key数量.
+// 大对象的分块不计数,随清单在后台删除
+func (g *Group) DeletePattern(pattern string) (int, error) {
+	return g.DeletePatternContext(context.Background(), pattern)
+}
+
+// DeletePatternContext 与DeletePattern相同,ctx会传递到远程节点.
+// 部分节点失败时返回成功删除的数量以及所有错误
+func (g *Group) DeletePatternContext(ctx context.Context, pattern string) (int, error) {
+	n, err := g.DeletePatternLocally(pattern)
+	if err != nil || g.peers == nil {
+		return n, err
+	}
+	all := g.peers.AllPeers()
+	counts := make([]int, len(all))
+	errs := make([]error, len(all))
+	var wg sync.WaitGroup
+	for i, peer := range all {
+		wg.Add(1)
+		go func(i int, peer peers.PeerGetter) {
+			defer wg.Done()
+			counts[i], errs[i] = peer.DeletePattern(ctx, g.name, pattern)
+		}(i, peer)
+	}
+	wg.Wait()
+	for _, c := range counts {
+		n += c
+	}
+	if err := errors.Join(errs...); err != nil {
+		groupLogger.Info("failed to delete pattern [%s] on peers: %v", pattern, err)
+		return n, err
+	}
+	return n, nil
+}
+
+// DeletePatternLocally 删除本地缓存和热点缓存中匹配glob模式的key,不经过远程节点,
+// 用于处理其他节点广播的请求.返回主缓存中删除的key数量,热点副本不计数
+func (g *Group) DeletePatternLocally(pattern string) (int, error) {
+	if pattern == "" {
+		return 0, fmt.Errorf("pattern is required")
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, s := range g.mainCache.shards {
+		_, n := s.deleteMatch(re.MatchString)
+		total += n
+	}
+	if g.hotCache != nil {
+		for _, s := range g.hotCache.shards {
+			s.deleteMatch(re.MatchString)
+		}
+	}
+	if total > 0 {
+		groupLogger.Info("delete %d keys matching [%s]", total, pattern)
+	}
+	return total, nil
+}
@@ -0,0 +1,266 @@
+package mycache
+
+import (
+	"TDKCache/cache/lru"
+	"TDKCache/peers"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScanLimit = 100 // 每次Scan默认返回的key数量
+	maxKeyLevel      = 24  // 排序索引的最大层数
+	// 大于所有分块key的最小字符串,遍历时用于跳过分块
+	chunkKeyEnd = "\x00chunk;"
+)
+
+// ErrInvalidCursor 表示Scan的游标无法解析
+var ErrInvalidCursor = errors.New("invalid scan cursor")
+
+// KeyInfo 是Scan返回的key的信息
+type KeyInfo struct {
+	Key  string
+	Size int           // 值实际占用的字节数
+	Hot  bool          // 是否在热数据区
+	TTL  time.Duration // 剩余存活时间,0表示永不过期
+}
+
+// keyIndex 是按照key排序的跳表,Scan从游标处开始遍历,不需要遍历和排序整个分片
+type keyIndex struct {
+	head  keyNode
+	level int
+}
+
+type keyNode struct {
+	key  string
+	next []*keyNode
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{head: keyNode{next: make([]*keyNode, maxKeyLevel)}, level: 1}
+}
+
+// find 返回每一层中最后一个小于key的节点
+func (x *keyIndex) find(key string, prev *[maxKeyLevel]*keyNode) *keyNode {
+	n := &x.head
+	for i := x.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].key < key {
+			n = n.next[i]
+		}
+		if prev != nil {
+			prev[i] = n
+		}
+	}
+	return n
+}
+
+// insert 加入key,key已经存在时什么都不做
+func (x *keyIndex) insert(key string) {
+	var prev [maxKeyLevel]*keyNode
+	if n := x.find(key, &prev).next[0]; n != nil && n.key == key {
+		return
+	}
+	level := 1
+	for level < maxKeyLevel && rand.Uint32()&3 == 0 {
+		level++
+	}
+	for ; x.level < level; x.level++ {
+		prev[x.level] = &x.head
+	}
+	n := &keyNode{key: key, next: make([]*keyNode, level)}
+	for i := range n.next {
+		n.next[i], prev[i].next[i] = prev[i].next[i], n
+	}
+}
+
+// remove 删除key,key不存在时什么都不做
+func (x *keyIndex) remove(key string) {
+	var prev [maxKeyLevel]*keyNode
+	n := x.find(key, &prev).next[0]
+	if n == nil || n.key != key {
+		return
+	}
+	for i := range n.next {
+		prev[i].next[i] = n.next[i]
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+}
+
+// seek 返回第一个大于等于key的节点
+func (x *keyIndex) seek(key string) *keyNode {
+	return x.find(key, nil).next[0]
+}
+
+// indexLocked 在写入key之后按照key是否仍在缓存中更新排序索引,调用者需要持有锁.
+// 淘汰策略可能拒绝写入,或者在写入时立即淘汰key
+func (s *cacheShard) indexLocked(key string) {
+	if _, ok := s.lru.Peek(key); ok {
+		s.keys.insert(key)
+	} else {
+		s.keys.remove(key)
+	}
+}
+
+// scan 返回分片中以prefix开头且大于after的key,按照key排序后最多返回limit个,
+// more表示分片中是否还有剩余的key.从after开始遍历排序索引,不包括负缓存和大对象的分块
+func (s *cacheShard) scan(prefix, after string, limit int) (keys []KeyInfo, more bool) {
+	s.lck.Lock()
+	defer s.unlock()
+	start := prefix
+	if next := after + "\x00"; after != "" && next > start {
+		// 大于after的最小的key
+		start = next
+	}
+	now := s.clock.Now()
+	for n := s.keys.seek(start); n != nil && strings.HasPrefix(n.key, prefix); n = n.next[0] {
+		if isChunkKey(n.key) {
+			if n = s.keys.seek(chunkKeyEnd); n == nil {
+				break
+			}
+			if !strings.HasPrefix(n.key, prefix) {
+				break
+			}
+		}
+		v, hot, ok := lru.PeekRegion(s.lru, n.key)
+		if !ok {
+			continue
+		}
+		it := v.(*item)
+		info, ok := s.exMap.keyExpireMap[n.key]
+		if it.notFound || ok && !info.at.After(now) {
+			continue
+		}
+		if len(keys) == limit {
+			return keys, true
+		}
+		k := KeyInfo{Key: n.key, Size: it.Len(), Hot: hot}
+		if ok {
+			k.TTL = info.at.Sub(now)
+		}
+		keys = append(keys, k)
+	}
+	return keys, false
+}
+
+// Scan 返回本节点主缓存中以prefix开头的key,每次最多返回limit个.
+// cursor为空时从头开始,之后传入上一次返回的游标,返回的游标为空时表示遍历结束.
+// 每个分片内按照key的顺序遍历,遍历期间写入的key可能不会被返回
+func (g *Group) Scan(prefix, cursor string, limit int) ([]KeyInfo, string, error) {
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	if g.closed.Load() {
+		return nil, "", ErrGroupClosed
+	}
+	shard, after, err := decodeScanCursor(cursor)
+	if err != nil || shard >= len(g.mainCache.shards) {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var keys []KeyInfo
+	for ; shard < len(g.mainCache.shards); shard, after = shard+1, "" {
+		infos, more := g.mainCache.shards[shard].scan(prefix, after, limit-len(keys))
+		keys = append(keys, infos...)
+		if more {
+			return keys, encodeScanCursor(shard, keys[len(keys)-1].Key), nil
+		}
+		if len(keys) == limit && shard+1 < len(g.mainCache.shards) {
+			return keys, encodeScanCursor(shard+1, ""), nil
+		}
+	}
+	return keys, "", nil
+}
+
+// ScanEverywhere 返回所有节点中以prefix开头的key,每个节点最多返回limit个
+func (g *Group) ScanEverywhere(ctx context.Context, prefix string, limit int) ([]KeyInfo, error) {
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	var all []peers.PeerGetter
+	if g.peers != nil {
+		all = g.peers.AllPeers()
+	}
+	results := make([][]KeyInfo, len(all)+1)
+	errs := make([]error, len(all)+1)
+	results[0], errs[0] = collectKeys(g.Scan, prefix, limit)
+	var wg sync.WaitGroup
+	for i, peer := range all {
+		wg.Add(1)
+		go func(i int, peer peers.PeerGetter) {
+			defer wg.Done()
+			results[i], errs[i] = collectKeys(func(prefix, cursor string, limit int) ([]KeyInfo, string, error) {
+				return g.scanPeer(ctx, peer, prefix, cursor, limit)
+			}, prefix, limit)
+		}(i+1, peer)
+	}
+	wg.Wait()
+
+	var keys []KeyInfo
+	for _, r := range results {
+		keys = append(keys, r...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		groupLogger.Info("failed to scan peers: %v", err)
+		return keys, err
+	}
+	return keys, nil
+}
+
+// collectKeys 使用scan遍历,直到得到limit个key或者遍历结束
+func collectKeys(scan func(prefix, cursor string, limit int) ([]KeyInfo, string, error), prefix string, limit int) ([]KeyInfo, error) {
+	var keys []KeyInfo
+	cursor := ""
+	for {
+		infos, next, err := scan(prefix, cursor, limit-len(keys))
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, infos...)
+		if next == "" || len(keys) >= limit {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+func (g *Group) scanPeer(ctx context.Context, peer peers.PeerGetter, prefix, cursor string, limit int) ([]KeyInfo, string, error) {
+	infos, next, err := peer.Scan(ctx, g.name, prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := make([]KeyInfo, len(infos))
+	for i, info := range infos {
+		keys[i] = KeyInfo{Key: info.Key, Size: info.Size, Hot: info.Hot, TTL: info.TTL}
+	}
+	return keys, next, nil
+}
+
+// 游标由分片编号和该分片中上一次返回的最后一个key组成
+func encodeScanCursor(shard int, after string) string {
+	buf := binary.AppendUvarint(nil, uint64(shard))
+	return base64.RawURLEncoding.EncodeToString(append(buf, after...))
+}
+
+func decodeScanCursor(cursor string) (int, string, error) {
+	if cursor == "" {
+		return 0, "", nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", err
+	}
+	shard, n := binary.Uvarint(buf)
+	if n <= 0 || shard > 1<<16 {
+		return 0, "", fmt.Errorf("bad shard in cursor")
+	}
+	return int(shard), string(buf[n:]), nil
+}
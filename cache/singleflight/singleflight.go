@@ -1,13 +1,17 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // call是正在执行或已完成的一个请求
 type call struct {
-	wg  sync.WaitGroup // 使用waitgrou避免重入
-	val interface{}    // 请求返回值
-	err error          // 错误
-	cnt int            // 计数
+	done chan struct{}   // 请求完成后关闭,等待者可以同时等待自己的ctx
+	ctx  context.Context // 发起请求的调用方的ctx
+	val  interface{}     // 请求返回值
+	err  error           // 错误
+	cnt  int             // 计数
 }
 
 // Group包含了若干组执行中的call
@@ -25,27 +29,57 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	}
 	if c, ok := g.m[key]; ok {
 		// 如果哈希表中已经有对key的请求进行中，则避免重入，等待已有请求的返回结果
-		g.mu.Unlock()
 		c.cnt++
+		g.mu.Unlock()
 		// 等到已有请求c完成
-		c.wg.Wait()
+		<-c.done
+		return c.val, c.err
+	}
+	return g.doCall(context.Background(), key, fn)
+}
+
+// DoContext与Do相同，但等待已有请求的调用方在自己的ctx结束时立即返回ctx.Err()。
+// fn应当使用ctx，如果发起请求的调用方的ctx先结束，仍在等待的调用方会重新发起请求
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	for {
+		g.mu.Lock()
+		if g.m == nil {
+			g.m = make(map[string]*call)
+		}
+		c, ok := g.m[key]
+		if !ok {
+			return g.doCall(ctx, key, fn)
+		}
+		c.cnt++
+		g.mu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.ctx.Err() != nil && ctx.Err() == nil {
+			// 发起请求的调用方已经放弃，结果不可用
+			continue
+		}
 		return c.val, c.err
 	}
-	// 如果没有进行中的请求，则创建
-	c := new(call)
-	c.wg.Add(1)
+}
+
+// doCall 创建并执行请求，调用时需要持有锁
+func (g *Group) doCall(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	c := &call{done: make(chan struct{}), ctx: ctx}
 	g.m[key] = c
 	g.mu.Unlock()
 
 	// 运行fn函数
 	c.val, c.err = fn()
-	c.wg.Done()
 
 	// 请求结束，删除哈希表中对应的call
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+	close(c.done)
 
 	return c.val, c.err
-
 }
@@ -0,0 +1,396 @@
+package mycache
+
+import (
+	"TDKCache/cache/lru"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照文件格式:
+//
+//	header:  magic "TDKS" | version uint16 | 保存时间 int64(Unix毫秒)
+//	entry:   flags byte | key长度 uvarint | key | value长度 uvarint | value |
+//	         ttl varint | 剩余存活时间 varint | 距离最长存活时间的剩余时间 varint (毫秒) |
+//	         [标签数量 uvarint | (标签长度 uvarint | 标签)...]
+//	trailer: snapshotEnd byte | 之前所有字节的CRC32 uint32
+//
+// 整数使用大端序,flags的最低位表示数据是否在热数据区,第二位表示是否包含方括号中的标签,
+// 第三位表示value是大对象的分块清单
+const (
+	snapshotMagic   = "TDKS"
+	snapshotVersion = 1
+	snapshotExt     = ".snap"
+
+	snapshotHot      = 1 << 0    // 数据在热数据区
+	snapshotTags     = 1 << 1    // 数据带有标签
+	snapshotManifest = 1 << 2    // 数据是分块清单
+	snapshotEnd      = byte(255) // 数据结束标记
+	// 单个key或value的最大长度,避免损坏的长度字段导致分配过多内存
+	maxSnapshotBytes = 1 << 30
+)
+
+var (
+	ErrSnapshotCorrupted = errors.New("snapshot corrupted")
+	ErrSnapshotVersion   = errors.New("unsupported snapshot version")
+)
+
+// snapshotEntry 是快照中的一条数据
+type snapshotEntry struct {
+	key       string
+	value     ByteView
+	hot       bool
+	ttl       time.Duration // 写入时的存活时间
+	remaining time.Duration // 剩余存活时间
+	deadline  time.Duration // 距离最长存活时间的剩余时间,0表示没有限制
+	tags      []string
+	manifest  bool // value是分块清单
+}
+
+// snapshot 返回分片中未过期的数据,不包括负缓存.压缩的值保持压缩状态
+func (s *cacheShard) snapshot() []snapshotEntry {
+	s.lck.Lock()
+	defer s.unlock()
+	now := s.clock.Now()
+	entries := make([]snapshotEntry, 0, s.lru.Len())
+	s.lru.Range(func(key string, value lru.Value, hot bool) bool {
+		it := value.(*item)
+		info, ok := s.exMap.keyExpireMap[key]
+		if it.notFound || !ok || !info.at.After(now) {
+			return true
+		}
+		e := snapshotEntry{key: key, value: it.view, hot: hot, ttl: info.ttl, remaining: info.at.Sub(now), tags: it.tags, manifest: it.manifest}
+		if !info.deadline.IsZero() {
+			e.deadline = info.deadline.Sub(now)
+		}
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+// restore 将快照中的数据恢复到原来所在的区域
+func (s *cacheShard) restore(e snapshotEntry) bool {
+	s.lck.Lock()
+	defer s.unlock()
+	now := s.clock.Now()
+	info := expireInfo{at: now.Add(e.remaining), ttl: e.ttl}
+	if e.deadline > 0 {
+		info.deadline = now.Add(e.deadline)
+	}
+	it := &item{view: e.value, loadedAt: now.Add(e.remaining - e.ttl), ttl: e.ttl, version: s.version.Add(1), tags: e.tags, manifest: e.manifest}
+	v, _ := s.lru.Peek(e.key)
+	s.exMap.setExpire(e.key, info)
+	s.tags.add(e.key, it.tags)
+	ok := lru.Restore(s.lru, e.key, it, e.hot, now.Unix())
+	old, _ := v.(*item)
+	s.retagLocked(e.key, old, it, ok)
+	s.indexLocked(e.key)
+	return ok
+}
+
+// SaveSnapshot 将主缓存中未过期的数据写入w,不包括负缓存和热点缓存
+func (g *Group) SaveSnapshot(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	header := make([]byte, len(snapshotMagic)+2+8)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], snapshotVersion)
+	binary.BigEndian.PutUint64(header[len(snapshotMagic)+2:], uint64(g.mainCache.clock.Now().UnixMilli()))
+	bw.Write(header)
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf, v)])
+	}
+	writeVarint := func(v int64) {
+		bw.Write(buf[:binary.PutVarint(buf, v)])
+	}
+	for _, s := range g.mainCache.shards {
+		for _, e := range s.snapshot() {
+			// 快照中保存压缩前的数据,恢复时按照当前配置压缩
+			value, err := e.value.decompress()
+			if err != nil {
+				groupLogger.Error("skip key [%s] in snapshot: %v", e.key, err)
+				continue
+			}
+			var flags byte
+			if e.hot {
+				flags |= snapshotHot
+			}
+			if len(e.tags) > 0 {
+				flags |= snapshotTags
+			}
+			if e.manifest {
+				flags |= snapshotManifest
+			}
+			bw.WriteByte(flags)
+			writeUvarint(uint64(len(e.key)))
+			bw.WriteString(e.key)
+			data := value.bytes()
+			writeUvarint(uint64(len(data)))
+			bw.Write(data)
+			writeVarint(e.ttl.Milliseconds())
+			writeVarint(e.remaining.Milliseconds())
+			writeVarint(e.deadline.Milliseconds())
+			if len(e.tags) > 0 {
+				writeUvarint(uint64(len(e.tags)))
+				for _, tag := range e.tags {
+					writeUvarint(uint64(len(tag)))
+					bw.WriteString(tag)
+				}
+			}
+		}
+	}
+	bw.WriteByte(snapshotEnd)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+	_, err := w.Write(sum)
+	return err
+}
+
+// LoadSnapshot 读取SaveSnapshot写入的快照并恢复到主缓存,
+// 跳过已经过期的数据,返回恢复的数据数量.校验失败时不会恢复任何数据
+func (g *Group) LoadSnapshot(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	tr := &crcReader{r: br, crc: crc32.NewIEEE()}
+
+	header := make([]byte, len(snapshotMagic)+2+8)
+	if _, err := io.ReadFull(tr, header); err != nil {
+		return 0, snapshotError(err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, ErrSnapshotCorrupted
+	}
+	if v := binary.BigEndian.Uint16(header[len(snapshotMagic):]); v != snapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, v)
+	}
+	savedAt := time.UnixMilli(int64(binary.BigEndian.Uint64(header[len(snapshotMagic)+2:])))
+
+	var entries []snapshotEntry
+	for {
+		flags, err := tr.ReadByte()
+		if err != nil {
+			return 0, snapshotError(err)
+		}
+		if flags == snapshotEnd {
+			break
+		}
+		e := snapshotEntry{hot: flags&snapshotHot != 0, manifest: flags&snapshotManifest != 0}
+		key, err := readBytes(tr)
+		if err != nil {
+			return 0, snapshotError(err)
+		}
+		value, err := readBytes(tr)
+		if err != nil {
+			return 0, snapshotError(err)
+		}
+		e.key, e.value = string(key), g.restoredValue(value, e.manifest)
+		var ms [3]int64
+		for i := range ms {
+			if ms[i], err = binary.ReadVarint(tr); err != nil {
+				return 0, snapshotError(err)
+			}
+		}
+		e.ttl, e.remaining, e.deadline = time.Duration(ms[0])*time.Millisecond,
+			time.Duration(ms[1])*time.Millisecond, time.Duration(ms[2])*time.Millisecond
+		if flags&snapshotTags != 0 {
+			if e.tags, err = readTags(tr); err != nil {
+				return 0, snapshotError(err)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	// 校验和本身不计入CRC
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(br, sum); err != nil {
+		return 0, snapshotError(err)
+	}
+	if binary.BigEndian.Uint32(sum) != tr.crc.Sum32() {
+		return 0, ErrSnapshotCorrupted
+	}
+
+	// 扣除保存快照之后经过的时间
+	elapsed := g.mainCache.clock.Now().Sub(savedAt)
+	n := 0
+	for _, e := range entries {
+		if e.remaining -= elapsed; e.remaining <= 0 {
+			continue
+		}
+		if e.deadline > 0 {
+			if e.deadline -= elapsed; e.deadline <= 0 {
+				continue
+			}
+		}
+		if g.mainCache.shard(e.key).restore(e) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// restoredValue 返回从快照或追加日志恢复的值,按照当前配置压缩,分块清单不压缩
+func (g *Group) restoredValue(data []byte, manifest bool) ByteView {
+	if manifest {
+		return ByteView{data: data}
+	}
+	return g.compress(ByteView{data: data})
+}
+
+// crcReader 计算已经读取的字节的CRC32
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (r *crcReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.crc.Write(p[:n])
+	return n, err
+}
+
+func (r *crcReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// readBytes 读取以uvarint长度为前缀的字节串
+func readBytes(r *crcReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotBytes {
+		return nil, ErrSnapshotCorrupted
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readTags 读取标签数量以及各个标签
+func readTags(r *crcReader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotBytes {
+		return nil, ErrSnapshotCorrupted
+	}
+	var tags []string
+	for i := uint64(0); i < n; i++ {
+		tag, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, string(tag))
+	}
+	return tags, nil
+}
+
+// snapshotError 将读取到文件末尾的错误转换为ErrSnapshotCorrupted
+func snapshotError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+	}
+	return err
+}
+
+// snapshotPath 返回group的快照文件路径
+func snapshotPath(dir, name string) string {
+	return filepath.Join(dir, url.PathEscape(name)+snapshotExt)
+}
+
+// SaveSnapshots 将所有group的快照写入dir,每个group一个文件.
+// 先写入临时文件再重命名,保存失败时不会破坏已有的快照
+func SaveSnapshots(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+
+	var errs []error
+	for _, g := range all {
+		if err := g.saveSnapshotFile(snapshotPath(dir, g.name)); err != nil {
+			errs = append(errs, fmt.Errorf("group %s: %w", g.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Group) saveSnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = g.SaveSnapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshots 从dir中恢复已经创建的group的快照,没有快照文件的group会被跳过.
+// 开启追加日志的group已经从日志恢复了最新的数据,较旧的快照会覆盖之后的写入和删除,也会被跳过
+func LoadSnapshots(dir string) error {
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+
+	var errs []error
+	for _, g := range all {
+		if g.aof != nil {
+			groupLogger.Info("group [%s] is restored from append log, skip snapshot", g.name)
+			continue
+		}
+		f, err := os.Open(snapshotPath(dir, g.name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n, err := g.LoadSnapshot(f)
+		f.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("group %s: %w", g.name, err))
+			continue
+		}
+		groupLogger.Info("restored %d keys of group [%s] from snapshot", n, g.name)
+	}
+	return errors.Join(errs...)
+}
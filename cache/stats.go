@@ -0,0 +1,104 @@
+package mycache
+
+import (
+	"TDKCache/cache/lru"
+	"sync/atomic"
+)
+
+// Stats 是Group的统计数据
+type Stats struct {
+	Gets          int64 // Get请求次数
+	Hits          int64 // 命中主缓存的次数
+	NegativeHits  int64 // 命中负缓存的次数,包含在Hits中
+	HotHits       int64 // 命中热点缓存的次数,不包含在Hits中
+	Misses        int64 // 未命中主缓存和热点缓存的次数
+	PeerLoads     int64 // 从远程节点加载成功的次数
+	PeerErrors    int64 // 从远程节点加载失败的次数
+	LocalLoads    int64 // 通过Getter加载成功的次数
+	LocalLoadErrs int64 // 通过Getter加载失败的次数
+	DedupedLoads  int64 // 与其他请求合并,没有实际执行的加载次数
+	Refreshes     int64 // 在后台提前刷新的次数
+	RefreshErrs   int64 // 提前刷新失败的次数
+	Evictions     int64 // 因超出容量被淘汰的数据数量
+	Expirations   int64 // 过期被删除的数据数量
+
+	HeatBytes int64 // 热数据区占用的字节数
+	HeatItems int64 // 热数据区的数据数量
+	ColdBytes int64 // 冷数据区占用的字节数
+	ColdItems int64 // 冷数据区的数据数量
+	HotBytes  int64 // 热点缓存占用的字节数
+	HotItems  int64 // 热点缓存的数据数量
+
+	UncompressedBytes int64   // 被压缩的值压缩前的总字节数
+	CompressedBytes   int64   // 被压缩的值压缩后的总字节数
+	CompressionRatio  float64 // 压缩后与压缩前的大小之比,没有压缩过数据时为0
+}
+
+// groupStats 是Group内部使用的原子计数器
+type groupStats struct {
+	gets          atomic.Int64
+	hits          atomic.Int64
+	negativeHits  atomic.Int64
+	hotHits       atomic.Int64
+	misses        atomic.Int64
+	peerLoads     atomic.Int64
+	peerErrors    atomic.Int64
+	localLoads    atomic.Int64
+	localLoadErrs atomic.Int64
+	dedupedLoads  atomic.Int64
+	refreshes     atomic.Int64
+	refreshErrs   atomic.Int64
+	evictions     atomic.Int64
+	expirations   atomic.Int64
+
+	uncompressedBytes atomic.Int64
+	compressedBytes   atomic.Int64
+}
+
+// Stats 返回Group统计数据的快照
+func (g *Group) Stats() Stats {
+	u := g.mainCache.usage()
+	var hot lru.Usage
+	if g.hotCache != nil {
+		hot = g.hotCache.usage()
+	}
+	s := Stats{
+		Gets:          g.stats.gets.Load(),
+		Hits:          g.stats.hits.Load(),
+		NegativeHits:  g.stats.negativeHits.Load(),
+		HotHits:       g.stats.hotHits.Load(),
+		Misses:        g.stats.misses.Load(),
+		PeerLoads:     g.stats.peerLoads.Load(),
+		PeerErrors:    g.stats.peerErrors.Load(),
+		LocalLoads:    g.stats.localLoads.Load(),
+		LocalLoadErrs: g.stats.localLoadErrs.Load(),
+		DedupedLoads:  g.stats.dedupedLoads.Load(),
+		Refreshes:     g.stats.refreshes.Load(),
+		RefreshErrs:   g.stats.refreshErrs.Load(),
+		Evictions:     g.stats.evictions.Load(),
+		Expirations:   g.stats.expirations.Load(),
+		HeatBytes:     u.HeatBytes,
+		HeatItems:     u.HeatItems,
+		ColdBytes:     u.ColdBytes,
+		ColdItems:     u.ColdItems,
+		HotBytes:      hot.HeatBytes + hot.ColdBytes,
+		HotItems:      hot.HeatItems + hot.ColdItems,
+
+		UncompressedBytes: g.stats.uncompressedBytes.Load(),
+		CompressedBytes:   g.stats.compressedBytes.Load(),
+	}
+	if s.UncompressedBytes > 0 {
+		s.CompressionRatio = float64(s.CompressedBytes) / float64(s.UncompressedBytes)
+	}
+	return s
+}
+
+// recordEviction 统计被淘汰和过期的数据
+func (g *Group) recordEviction(key string, value ByteView, reason EvictReason) {
+	switch reason {
+	case EvictCapacity:
+		g.stats.evictions.Add(1)
+	case EvictExpired:
+		g.stats.expirations.Add(1)
+	}
+}
@@ -0,0 +1,197 @@
+package mycache
+
+import (
+	"TDKCache/peers"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tagIndex 记录每个标签对应的key,数据被移出缓存时从索引中删除,调用者需要持有分片的锁
+type tagIndex map[string]map[string]struct{}
+
+func (idx tagIndex) add(key string, tags []string) {
+	for _, tag := range tags {
+		keys, ok := idx[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			idx[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// remove 删除key在tags中但不在keep中的标签
+func (idx tagIndex) remove(key string, tags []string, keep []string) {
+	for _, tag := range tags {
+		if containsTag(keep, tag) {
+			continue
+		}
+		if keys, ok := idx[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(idx, tag)
+			}
+		}
+	}
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTags 去掉空的和重复的标签
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		if tag != "" && !containsTag(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// retagLocked 在写入key之后更新标签索引,调用者需要在写入前将新数据的标签加入索引.
+// 写入成功时删除旧数据独有的标签,失败时删除新数据独有的标签
+func (s *cacheShard) retagLocked(key string, old *item, it *item, ok bool) {
+	var prev []string
+	if old != nil {
+		prev = old.tags
+	}
+	if ok {
+		s.tags.remove(key, prev, it.tags)
+	} else {
+		s.tags.remove(key, it.tags, prev)
+	}
+}
+
+// invalidateTag 删除分片中带有tag的key,返回被删除的key
+func (s *cacheShard) invalidateTag(tag string) []string {
+	s.lck.Lock()
+	defer s.unlock()
+	keys := make([]string, 0, len(s.tags[tag]))
+	for key := range s.tags[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		// 删除时回调函数会将key从索引中移除
+		s.remove(key, EvictDeleted)
+		s.logLocked(aofRecord{op: opDelete, key: key})
+	}
+	return keys
+}
+
+// SetWithTags 将带有标签的key写入负责该key的节点,使用默认的过期时间.
+// 通过InvalidateTag可以删除所有节点中带有某个标签的key
+func (g *Group) SetWithTags(key string, value []byte, tags ...string) error {
+	return g.SetWithTagsContext(context.Background(), key, value, 0, tags)
+}
+
+// SetLocallyWithTags 与SetLocally相同,同时记录key的标签
+func (g *Group) SetLocallyWithTags(key string, value []byte, ttl time.Duration, tags []string) error {
+	return g.setLocally(key, value, ttl, tags, false)
+}
+
+// SetManifestLocally 将大对象的分块清单写入本地缓存,用于处理其他节点转发的大对象写入.
+// 读取key时按照清单组装分块,清单格式错误时返回ErrInvalidManifest
+func (g *Group) SetManifestLocally(key string, manifest []byte, ttl time.Duration, tags []string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if _, err := decodeManifest(manifest); err != nil {
+		return fmt.Errorf("key [%s]: %w", key, err)
+	}
+	return g.setLocally(key, manifest, ttl, tags, true)
+}
+
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration, tags []string, manifest bool) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.closed.Load() {
+		return ErrGroupClosed
+	}
+
+	if ttl <= 0 {
+		ttl = expireTime
+	}
+	tags = normalizeTags(tags)
+	view := ByteView{data: cloneBytes(value)}
+	stored := view
+	if !manifest {
+		stored = g.compress(view)
+	}
+	_, err := g.mainCache.shard(key).write(key, func(*item) (*item, []byte, time.Duration, error) {
+		return &item{view: stored, tags: tags, manifest: manifest}, view.data, ttl, nil
+	})
+	if err != nil {
+		return err
+	}
+	g.removeHot(key)
+	return nil
+}
+
+// InvalidateTag 删除所有节点中带有tag的key,返回删除的key数量.
+// 带有同一标签的key分布在不同的节点,因此请求会广播到所有节点.
+// 与Delete相同,其他节点的热点副本在过期后失效
+func (g *Group) InvalidateTag(tag string) (int, error) {
+	return g.InvalidateTagContext(context.Background(), tag)
+}
+
+// InvalidateTagContext 与InvalidateTag相同,ctx会传递到远程节点.
+// 部分节点失败时返回成功删除的数量以及所有错误
+func (g *Group) InvalidateTagContext(ctx context.Context, tag string) (int, error) {
+	n, err := g.InvalidateTagLocally(tag)
+	if err != nil || g.peers == nil {
+		return n, err
+	}
+	all := g.peers.AllPeers()
+	counts := make([]int, len(all))
+	errs := make([]error, len(all))
+	var wg sync.WaitGroup
+	for i, peer := range all {
+		wg.Add(1)
+		go func(i int, peer peers.PeerGetter) {
+			defer wg.Done()
+			counts[i], errs[i] = peer.InvalidateTag(ctx, g.name, tag)
+		}(i, peer)
+	}
+	wg.Wait()
+	for _, c := range counts {
+		n += c
+	}
+	if err := errors.Join(errs...); err != nil {
+		groupLogger.Info("failed to invalidate tag [%s] on peers: %v", tag, err)
+		return n, err
+	}
+	return n, nil
+}
+
+// InvalidateTagLocally 删除本地缓存中带有tag的key,不经过远程节点,用于处理其他节点广播的请求
+func (g *Group) InvalidateTagLocally(tag string) (int, error) {
+	if tag == "" {
+		return 0, fmt.Errorf("tag is required")
+	}
+	if g.closed.Load() {
+		return 0, ErrGroupClosed
+	}
+
+	n := 0
+	for _, s := range g.mainCache.shards {
+		for _, key := range s.invalidateTag(tag) {
+			g.removeHot(key)
+			n++
+		}
+	}
+	if n > 0 {
+		groupLogger.Debug("invalidate %d keys with tag [%s]", n, tag)
+	}
+	return n, nil
+}
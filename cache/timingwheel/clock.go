@@ -0,0 +1,43 @@
+package timingwheel
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 提供当前时间,测试时可以替换为手动推进的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock 返回系统时间
+var RealClock Clock = realClock{}
+
+// FakeClock 是只能手动推进的时钟,用于在测试中确定性地控制过期
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 将时钟向前推进d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,204 @@
+package timingwheel
+
+import "time"
+
+const (
+	rootBits  = 8 // 第0层时间轮的槽数为2^8
+	levelBits = 6 // 其余各层时间轮的槽数为2^6
+	levels    = 5 // 时间轮层数,以1ms为刻度时可以覆盖约49天
+
+	rootSize  = 1 << rootBits
+	levelSize = 1 << levelBits
+)
+
+// timer 记录一个key的到期刻度及其所在的槽
+type timer struct {
+	key    string
+	expire int64 // 到期的刻度
+	level  int   // 所在的层
+	slot   int   // 所在的槽
+}
+
+// TimingWheel 是分层时间轮,第0层每个槽代表一个刻度,
+// 第l层每个槽代表第l-1层转完一圈的时间.
+// 当低层转完一圈时,将高层当前槽中的定时器下放到低层.
+// TimingWheel不是并发安全的,需要调用者加锁
+type TimingWheel struct {
+	tick    int64                       // 刻度(纳秒)
+	current int64                       // 已经处理到的刻度
+	slots   [levels][]map[string]*timer // 各层的槽
+	counts  [levels]int                 // 各层定时器的数量
+	timers  map[string]*timer           // 以key为索引的定时器
+	expired []string                    // 已到期但还未被取走的key
+}
+
+// New 创建刻度为tick的时间轮,从now开始计时
+func New(tick time.Duration, now time.Time) *TimingWheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	tw := &TimingWheel{
+		tick:   int64(tick),
+		timers: make(map[string]*timer),
+	}
+	tw.current = tw.floor(now)
+	tw.slots[0] = make([]map[string]*timer, rootSize)
+	for l := 1; l < levels; l++ {
+		tw.slots[l] = make([]map[string]*timer, levelSize)
+	}
+	return tw
+}
+
+// Add 设置key在expireAt时到期,如果key已经存在则更新其到期时间
+func (tw *TimingWheel) Add(key string, expireAt time.Time) {
+	tw.Remove(key)
+	t := &timer{key: key, expire: tw.ceil(expireAt)}
+	tw.timers[key] = t
+	tw.place(t)
+}
+
+// Remove 删除key的定时器
+func (tw *TimingWheel) Remove(key string) {
+	if t, ok := tw.timers[key]; ok {
+		delete(tw.slots[t.level][t.slot], key)
+		tw.counts[t.level]--
+		delete(tw.timers, key)
+	}
+}
+
+// Len 返回时间轮中定时器的数量
+func (tw *TimingWheel) Len() int {
+	return len(tw.timers)
+}
+
+// Advance 将时间轮推进到now,返回最多limit个已经到期的key,limit小于等于0时返回全部.
+// 超出limit的key会保留到下一次调用时返回,从而限制每次过期处理的工作量
+func (tw *TimingWheel) Advance(now time.Time, limit int) []string {
+	target := tw.floor(now)
+	for tw.current < target {
+		if len(tw.timers) == 0 {
+			// 没有定时器时直接跳到目标刻度
+			tw.current = target
+			break
+		}
+		next := tw.current + 1
+		if tw.counts[0] == 0 {
+			// 低层为空时,在最低的非空层下放之前不会有key到期,直接跳到下放的刻度
+			l := 1
+			for tw.counts[l] == 0 {
+				l++
+			}
+			span := spanOf(l)
+			next = (tw.current/span + 1) * span
+			if next > target {
+				tw.current = target
+				break
+			}
+		}
+		tw.current = next
+		tw.process(next)
+	}
+
+	n := len(tw.expired)
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	if n == 0 {
+		return nil
+	}
+	keys := tw.expired[:n:n]
+	tw.expired = tw.expired[n:]
+	if len(tw.expired) == 0 {
+		tw.expired = nil
+	}
+	return keys
+}
+
+// process 处理刻度t: 先将高层的定时器下放,再取出第0层当前槽中到期的key
+func (tw *TimingWheel) process(t int64) {
+	for l := 1; l < levels; l++ {
+		span := spanOf(l)
+		if t%span != 0 {
+			// 第l-1层还没有转完一圈
+			break
+		}
+		idx := int((t / span) % levelSize)
+		slot := tw.slots[l][idx]
+		tw.slots[l][idx] = nil
+		tw.counts[l] -= len(slot)
+		for _, tm := range slot {
+			tw.place(tm)
+		}
+	}
+
+	idx := int(t % rootSize)
+	slot := tw.slots[0][idx]
+	tw.slots[0][idx] = nil
+	tw.counts[0] -= len(slot)
+	for key := range slot {
+		tw.expire(key)
+	}
+}
+
+// place 根据定时器距离到期的刻度数将其放入对应层的槽中
+func (tw *TimingWheel) place(t *timer) {
+	delta := t.expire - tw.current
+	if delta <= 0 {
+		tw.expire(t.key)
+		return
+	}
+
+	expire := t.expire
+	level := 0
+	for level < levels-1 && delta >= rangeOf(level) {
+		level++
+	}
+	if delta >= rangeOf(level) {
+		// 超出时间轮范围的定时器放在最高层最远的槽中,下放时会重新计算位置
+		expire = tw.current + rangeOf(level) - 1
+	}
+
+	size := int64(levelSize)
+	if level == 0 {
+		size = rootSize
+	}
+	idx := int((expire / spanOf(level)) % size)
+	if tw.slots[level][idx] == nil {
+		tw.slots[level][idx] = make(map[string]*timer)
+	}
+	tw.slots[level][idx][t.key] = t
+	tw.counts[level]++
+	t.level, t.slot = level, idx
+}
+
+func (tw *TimingWheel) expire(key string) {
+	delete(tw.timers, key)
+	tw.expired = append(tw.expired, key)
+}
+
+func (tw *TimingWheel) floor(t time.Time) int64 {
+	return t.UnixNano() / tw.tick
+}
+
+// ceil 向上取整,保证处理到期刻度时key一定已经到期
+func (tw *TimingWheel) ceil(t time.Time) int64 {
+	ns := t.UnixNano()
+	ticks := ns / tw.tick
+	if ns%tw.tick != 0 {
+		ticks++
+	}
+	return ticks
+}
+
+// spanOf 返回第level层每个槽代表的刻度数
+func spanOf(level int) int64 {
+	if level == 0 {
+		return 1
+	}
+	return int64(1) << (rootBits + levelBits*(level-1))
+}
+
+// rangeOf 返回第level层能够覆盖的刻度数
+func rangeOf(level int) int64 {
+	return int64(1) << (rootBits + levelBits*level)
+}
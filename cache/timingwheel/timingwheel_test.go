@@ -0,0 +1,99 @@
+package timingwheel
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAdvance(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tw := New(time.Millisecond, start)
+
+	expires := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"k1", time.Millisecond * 10},
+		{"k2", time.Millisecond * 300},
+		{"k3", time.Second * 20},
+		{"k4", time.Hour * 2},
+		{"k5", time.Hour * 24 * 100},
+	}
+	for _, e := range expires {
+		tw.Add(e.key, start.Add(e.d))
+	}
+
+	for _, e := range expires {
+		k, d := e.key, e.d
+		// 到期前一刻不应被取出
+		if keys := tw.Advance(start.Add(d-time.Millisecond), 0); len(keys) != 0 {
+			t.Fatalf("keys %v expire too early, want %s at %v", keys, k, d)
+		}
+		if keys := tw.Advance(start.Add(d), 0); !reflect.DeepEqual(keys, []string{k}) {
+			t.Fatalf("expect [%s] expire at %v, but got %v", k, d, keys)
+		}
+	}
+
+	if tw.Len() != 0 {
+		t.Fatalf("expect empty timing wheel, but got %d timers", tw.Len())
+	}
+}
+
+func TestAddExisting(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tw := New(time.Millisecond, start)
+
+	tw.Add("key", start.Add(time.Second))
+	tw.Add("key", start.Add(time.Second*3))
+	if keys := tw.Advance(start.Add(time.Second*2), 0); len(keys) != 0 {
+		t.Fatalf("expect key to be rescheduled, but got %v", keys)
+	}
+	if keys := tw.Advance(start.Add(time.Second*3), 0); !reflect.DeepEqual(keys, []string{"key"}) {
+		t.Fatalf("expect [key] expire, but got %v", keys)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tw := New(time.Millisecond, start)
+
+	tw.Add("k1", start.Add(time.Second))
+	tw.Add("k2", start.Add(time.Second))
+	tw.Remove("k1")
+
+	if keys := tw.Advance(start.Add(time.Second), 0); !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("expect [k2] expire, but got %v", keys)
+	}
+}
+
+func TestAdvanceLimit(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tw := New(time.Millisecond, start)
+
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		tw.Add(k, start.Add(time.Millisecond*5))
+	}
+
+	now := start.Add(time.Millisecond * 5)
+	keys := tw.Advance(now, 2)
+	if len(keys) != 2 {
+		t.Fatalf("expect 2 keys, but got %v", keys)
+	}
+	keys = append(keys, tw.Advance(now, 2)...)
+	keys = append(keys, tw.Advance(now, 2)...)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"k1", "k2", "k3", "k4", "k5"}) {
+		t.Fatalf("expect all keys expire, but got %v", keys)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := NewFakeClock(start)
+	c.Advance(time.Second)
+	if !c.Now().Equal(start.Add(time.Second)) {
+		t.Fatalf("expect %v, but got %v", start.Add(time.Second), c.Now())
+	}
+}
@@ -5,11 +5,19 @@ import (
 	mycache "TDKCache/cache"
 	"TDKCache/peers"
 	"TDKCache/peers/rpc"
+	"TDKCache/service/conf"
+	"TDKCache/service/log"
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
+const defaultSnapshotInterval = 5 * time.Minute
+
 var (
 	db = map[string]string{
 		"Tom":  "630",
@@ -20,15 +28,19 @@ var (
 	s peers.PeerServer
 )
 
-func createGroup() *mycache.Group {
-	return mycache.NewGroup("scores", 2<<10, mycache.GetterFunc(
-		func(key string) ([]byte, error) {
-			// 模拟慢查询
-			time.Sleep(2 * time.Second)
+func createGroup() (*mycache.Group, error) {
+	return mycache.NewGroup("scores", 2<<10, mycache.GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			// 模拟慢查询,调用方放弃时立即返回
+			select {
+			case <-time.After(2 * time.Second):
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
 			if v, ok := db[key]; ok {
-				return []byte(v), nil
+				return []byte(v), 0, nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, 0, &mycache.NotFoundError{Key: key}
 		}))
 }
 
@@ -39,16 +51,65 @@ func main() {
 	flag.IntVar(&apiPort, "api", -1, "Frontend API port")
 	flag.Parse()
 
-	g := createGroup()
+	//s = http_server.NewHTTPPool(addrMap[port])
+	s = rpc.NewRPCServer(serverPort)
+	g, err := createGroup()
+	if err != nil {
+		panic(err)
+	}
+	dir := conf.Conf.GetString("snapshot.dir")
+	if dir != "" {
+		startSnapshots(dir, time.Duration(conf.Conf.GetInt64("snapshot.interval"))*time.Second)
+	}
+	handleShutdown(dir)
 
 	if apiPort != -1 {
 		// 开启api服务
 		apiAddr := fmt.Sprintf(":%d", apiPort)
-		p := api.NewAPIPool(apiAddr)
+		p := api.NewAPIPool(apiAddr, s)
 		go p.ListenAndServe()
 	}
 
-	//s = http_server.NewHTTPPool(addrMap[port])
-	s = rpc.NewRPCServer(serverPort)
 	s.Start(g)
 }
+
+// startSnapshots 从dir恢复缓存数据,之后每隔interval保存快照
+func startSnapshots(dir string, interval time.Duration) {
+	logger := log.NewLogger("Main", "Snapshot")
+	if err := mycache.LoadSnapshots(dir); err != nil {
+		logger.Error("load snapshots: %v", err)
+	}
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := mycache.SaveSnapshots(dir); err != nil {
+				logger.Error("save snapshots: %v", err)
+			}
+		}
+	}()
+}
+
+// handleShutdown 收到退出信号时保存快照(dir不为空时),然后关闭所有group,
+// 确保追加日志同步到磁盘后再退出
+func handleShutdown(dir string) {
+	logger := log.NewLogger("Main", "Shutdown")
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if dir != "" {
+			if err := mycache.SaveSnapshots(dir); err != nil {
+				logger.Error("save snapshots: %v", err)
+			}
+		}
+		if err := mycache.CloseGroups(); err != nil {
+			logger.Error("close groups: %v", err)
+		}
+		os.Exit(0)
+	}()
+}
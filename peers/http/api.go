@@ -4,7 +4,11 @@ import (
 	mycache "TDKCache/cache"
 	"TDKCache/peers/protobuf/pb"
 	"TDKCache/service/http_resp"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"google.golang.org/protobuf/proto"
@@ -13,6 +17,13 @@ import (
 func registerHandlers() *httprouter.Router {
 	router := httprouter.New()
 	router.GET("/TDKCache/PBGet", pbGetGroupKeyHandler)
+	router.PUT("/TDKCache/PBSet", pbSetGroupKeyHandler)
+	router.DELETE("/TDKCache/PBDel", pbDeleteGroupKeyHandler)
+	router.GET("/TDKCache/PBScan", pbScanGroupKeysHandler)
+	router.PUT("/TDKCache/PBCas", pbCompareAndSwapHandler)
+	router.PUT("/TDKCache/PBIncr", pbIncrHandler)
+	router.DELETE("/TDKCache/PBTag", pbInvalidateTagHandler)
+	router.DELETE("/TDKCache/PBDelPattern", pbDeletePatternHandler)
 	return router
 }
 
@@ -40,15 +51,397 @@ func pbGetGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.P
 		return
 	}
 
-	view, err := group.Get(key)
+	// 本节点负责该key,不需要查找热点缓存
+	res := group.GetVersioned(r.Context(), key)
+	if mycache.IsNotFound(res.Err) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorKeyUnexists)
+		return
+	} else if res.Err != nil {
+		hsLogger.Error("Internal error: %v", res.Err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	// 将得到的view编码为protobuf响应
+	body, err := proto.Marshal(&pb.Response{Value: res.Value.UnsafeBytes(), Ttl: res.TTL.Milliseconds(), Version: res.Version})
+	if err != nil {
+		hsLogger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func pbSetGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		hsLogger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	ttl, err := strconv.ParseInt(values.Get("ttl"), 10, 64)
 	if err != nil {
+		hsLogger.Error("invalid param [ttl]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		hsLogger.Error("reading request body: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	}
+
+	set := group.SetLocallyWithTags
+	if values.Get("manifest") == "1" {
+		// 其他节点切分后写入的大对象
+		set = group.SetManifestLocally
+	}
+	if err = set(key, value, time.Duration(ttl)*time.Millisecond, values["tag"]); errors.Is(err, mycache.ErrInvalidManifest) {
+		hsLogger.Error("invalid manifest: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	} else if err != nil {
 		hsLogger.Error("Internal error: %v", err)
 		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
 		return
 	}
 
-	// 将得到的view编码为protobuf响应
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write([]byte("ok"))
+}
+
+func pbDeleteGroupKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		hsLogger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	if err := group.DeleteLocally(key); err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write([]byte("ok"))
+}
+
+func pbCompareAndSwapHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		hsLogger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	version, err := strconv.ParseUint(values.Get("version"), 10, 64)
+	if err != nil {
+		hsLogger.Error("invalid param [version]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	ttl, err := strconv.ParseInt(values.Get("ttl"), 10, 64)
+	if err != nil {
+		hsLogger.Error("invalid param [ttl]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		hsLogger.Error("reading request body: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	}
+
+	cas := group.CompareAndSwapLocally
+	if values.Get("manifest") == "1" {
+		cas = group.CompareAndSwapManifestLocally
+	}
+	version, err = cas(key, version, value, time.Duration(ttl)*time.Millisecond)
+	if errors.Is(err, mycache.ErrVersionConflict) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorVersionConflict)
+		return
+	} else if errors.Is(err, mycache.ErrInvalidManifest) {
+		hsLogger.Error("invalid manifest: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorRequestBodyParseFailed)
+		return
+	} else if errors.Is(err, mycache.ErrReservedKey) {
+		hsLogger.Error("invalid param [key]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.Response{Version: version})
+	if err != nil {
+		hsLogger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func pbIncrHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	key := values.Get("key")
+	if key == "" {
+		hsLogger.Error("lack of necessary param [key]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	delta, err := strconv.ParseInt(values.Get("delta"), 10, 64)
+	if err != nil {
+		hsLogger.Error("invalid param [delta]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	initial, err := strconv.ParseInt(values.Get("initial"), 10, 64)
+	if err != nil {
+		hsLogger.Error("invalid param [initial]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	ttl, err := strconv.ParseInt(values.Get("ttl"), 10, 64)
+	if err != nil {
+		hsLogger.Error("invalid param [ttl]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	n, err := group.IncrLocally(key, delta, initial, time.Duration(ttl)*time.Millisecond)
+	if errors.Is(err, mycache.ErrNotInteger) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorNotInteger)
+		return
+	} else if errors.Is(err, mycache.ErrCounterOverflow) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorCounterOverflow)
+		return
+	} else if errors.Is(err, mycache.ErrReservedKey) {
+		hsLogger.Error("invalid param [key]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.Response{Value: strconv.AppendInt(nil, n, 10)})
+	if err != nil {
+		hsLogger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func pbInvalidateTagHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	tag := values.Get("tag")
+	if tag == "" {
+		hsLogger.Error("lack of necessary param [tag]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	n, err := group.InvalidateTagLocally(tag)
+	if err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.CountResponse{Count: int64(n)})
+	if err != nil {
+		hsLogger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func pbDeletePatternHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	pattern := values.Get("pattern")
+	if pattern == "" {
+		hsLogger.Error("lack of necessary param [pattern]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	n, err := group.DeletePatternLocally(pattern)
+	if errors.Is(err, mycache.ErrInvalidPattern) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.CountResponse{Count: int64(n)})
+	if err != nil {
+		hsLogger.Error("Encoding response error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func pbScanGroupKeysHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	values := r.URL.Query()
+
+	groupName := values.Get("group")
+	if groupName == "" {
+		hsLogger.Error("lack of necessary param [group]")
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	limit, err := strconv.Atoi(values.Get("limit"))
+	if err != nil {
+		hsLogger.Error("invalid param [limit]: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		hsLogger.Error("no such group: %s", groupName)
+		http_resp.SendErrorResponse(w, http_resp.ErrorGroupUnexists)
+		return
+	}
+
+	keys, cursor, err := group.Scan(values.Get("prefix"), values.Get("cursor"), limit)
+	if errors.Is(err, mycache.ErrInvalidCursor) {
+		http_resp.SendErrorResponse(w, http_resp.ErrorURLParamsParseFailed)
+		return
+	} else if err != nil {
+		hsLogger.Error("Internal error: %v", err)
+		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
+		return
+	}
+
+	out := &pb.ScanResponse{Keys: make([]*pb.KeyInfo, len(keys)), Cursor: cursor}
+	for i, k := range keys {
+		out.Keys[i] = &pb.KeyInfo{Key: k.Key, Size: int64(k.Size), Hot: k.Hot, Ttl: k.TTL.Milliseconds()}
+	}
+	body, err := proto.Marshal(out)
 	if err != nil {
 		hsLogger.Error("Encoding response error: %v", err)
 		http_resp.SendErrorResponse(w, http_resp.ErrorInternalFaults)
@@ -1,15 +1,22 @@
 package http_server
 
 import (
+	mycache "TDKCache/cache"
 	"TDKCache/peers"
 	"TDKCache/peers/protobuf/pb"
 	"TDKCache/service/consistenthash"
+	"TDKCache/service/http_resp"
 	"TDKCache/service/log"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"google.golang.org/protobuf/proto"
@@ -75,6 +82,19 @@ func (p *HTTPPool) PickPeer(key string) (peers.PeerGetter, bool) {
 	return nil, false
 }
 
+func (p *HTTPPool) AllPeers() []peers.PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	all := make([]peers.PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			all = append(all, getter)
+		}
+	}
+	return all
+}
+
 func (p *HTTPPool) Start(addrs []string, g peers.GroupCache) {
 	p.Set(addrs...)
 	g.RegisterPeers(p)
@@ -89,7 +109,12 @@ type httpGetter struct {
 
 // 使用HTTP利用protobuf传输
 
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+func (h *httpGetter) Get(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	r, err := h.GetVersion(ctx, group, key)
+	return r.Value, r.TTL, err
+}
+
+func (h *httpGetter) GetVersion(ctx context.Context, group string, key string) (peers.KeyResult, error) {
 	u := fmt.Sprintf(
 		"http://%v/PBGet?group=%v&key=%v",
 		h.baseURL,
@@ -97,30 +122,346 @@ func (h *httpGetter) Get(group string, key string) ([]byte, error) {
 		url.QueryEscape(key),
 	)
 	hsLogger.Debug("send get request: %v", u)
-	res, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return nil, err
+		return peers.KeyResult{}, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return peers.KeyResult{}, err
 	}
 
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
+	if res.StatusCode == http.StatusNotFound && errorCode(res.Body) == http_resp.ErrorKeyUnexists.Error.ErrorCode {
+		// 远程节点确认key不存在
+		return peers.KeyResult{}, &mycache.NotFoundError{Key: key}
+	} else if res.StatusCode != http.StatusOK {
 		hsLogger.Error("server return: %v", res.Status)
-		return nil, fmt.Errorf("server return: %v", res.Status)
+		return peers.KeyResult{}, fmt.Errorf("server return: %v", res.Status)
 	}
 
 	bytes, err := io.ReadAll(res.Body)
 	if err != nil {
 		hsLogger.Error("reading response body: %v", err)
-		return nil, fmt.Errorf("reading response body: %v", err)
+		return peers.KeyResult{}, fmt.Errorf("reading response body: %v", err)
 	}
 
 	out := &pb.Response{}
 	// 解码protobuf响应
 	if err = proto.Unmarshal(bytes, out); err != nil {
 		hsLogger.Error("decoding response body: %v", err)
-		return nil, fmt.Errorf("decoding response body: %v", err)
+		return peers.KeyResult{}, fmt.Errorf("decoding response body: %v", err)
+	}
+
+	return peers.KeyResult{
+		Key:     key,
+		Value:   out.Value,
+		TTL:     time.Duration(out.Ttl) * time.Millisecond,
+		Version: out.Version,
+	}, nil
+}
+
+func (h *httpGetter) Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	return h.SetWithTags(ctx, group, key, value, ttl, nil)
+}
+
+func (h *httpGetter) SetWithTags(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string) error {
+	return h.set(ctx, group, key, value, ttl, tags, false)
+}
+
+func (h *httpGetter) SetManifest(ctx context.Context, group string, key string, manifest []byte, ttl time.Duration, tags []string) error {
+	return h.set(ctx, group, key, manifest, ttl, tags, true)
+}
+
+func (h *httpGetter) set(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string, manifest bool) error {
+	u := fmt.Sprintf(
+		"http://%v/PBSet?group=%v&key=%v&ttl=%d",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+		ttl.Milliseconds(),
+	)
+	for _, tag := range tags {
+		u += "&tag=" + url.QueryEscape(tag)
+	}
+	if manifest {
+		u += "&manifest=1"
+	}
+	hsLogger.Debug("send set request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return fmt.Errorf("server return: %v", res.Status)
+	}
+	return nil
+}
+
+func (h *httpGetter) Delete(ctx context.Context, group string, key string) error {
+	u := fmt.Sprintf(
+		"http://%v/PBDel?group=%v&key=%v",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+	)
+	hsLogger.Debug("send delete request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return fmt.Errorf("server return: %v", res.Status)
+	}
+	return nil
+}
+
+// BatchGet 逐个获取key,HTTP通信没有批量获取的接口
+func (h *httpGetter) BatchGet(ctx context.Context, group string, keys []string) ([]peers.KeyResult, error) {
+	results := make([]peers.KeyResult, len(keys))
+	for i, key := range keys {
+		value, ttl, err := h.Get(ctx, group, key)
+		results[i] = peers.KeyResult{Key: key, Value: value, TTL: ttl, Err: err}
+	}
+	return results, nil
+}
+
+func (h *httpGetter) Scan(ctx context.Context, group string, prefix string, cursor string, limit int) ([]peers.KeyInfo, string, error) {
+	u := fmt.Sprintf(
+		"http://%v/PBScan?group=%v&prefix=%v&cursor=%v&limit=%d",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(prefix),
+		url.QueryEscape(cursor),
+		limit,
+	)
+	hsLogger.Debug("send scan request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return nil, "", fmt.Errorf("server return: %v", res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		hsLogger.Error("reading response body: %v", err)
+		return nil, "", fmt.Errorf("reading response body: %v", err)
+	}
+
+	out := &pb.ScanResponse{}
+	if err = proto.Unmarshal(body, out); err != nil {
+		hsLogger.Error("decoding response body: %v", err)
+		return nil, "", fmt.Errorf("decoding response body: %v", err)
+	}
+
+	keys := make([]peers.KeyInfo, len(out.Keys))
+	for i, k := range out.Keys {
+		keys[i] = peers.KeyInfo{Key: k.Key, Size: int(k.Size), Hot: k.Hot, TTL: time.Duration(k.Ttl) * time.Millisecond}
+	}
+	return keys, out.Cursor, nil
+}
+
+func (h *httpGetter) CompareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return h.compareAndSwap(ctx, group, key, version, value, ttl, false)
+}
+
+func (h *httpGetter) CompareAndSwapManifest(ctx context.Context, group string, key string, version uint64, manifest []byte, ttl time.Duration) (uint64, error) {
+	return h.compareAndSwap(ctx, group, key, version, manifest, ttl, true)
+}
+
+func (h *httpGetter) compareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration, manifest bool) (uint64, error) {
+	u := fmt.Sprintf(
+		"http://%v/PBCas?group=%v&key=%v&version=%d&ttl=%d",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+		version,
+		ttl.Milliseconds(),
+	)
+	if manifest {
+		u += "&manifest=1"
+	}
+	hsLogger.Debug("send cas request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(value))
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict && errorCode(res.Body) == http_resp.ErrorVersionConflict.Error.ErrorCode {
+		// 远程节点中key的版本号已经改变
+		return 0, fmt.Errorf("%w: key [%s] expect version %d", mycache.ErrVersionConflict, key, version)
+	} else if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return 0, fmt.Errorf("server return: %v", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		hsLogger.Error("reading response body: %v", err)
+		return 0, fmt.Errorf("reading response body: %v", err)
+	}
+	out := &pb.Response{}
+	if err = proto.Unmarshal(data, out); err != nil {
+		hsLogger.Error("decoding response body: %v", err)
+		return 0, fmt.Errorf("decoding response body: %v", err)
+	}
+	return out.Version, nil
+}
+
+func (h *httpGetter) Incr(ctx context.Context, group string, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	u := fmt.Sprintf(
+		"http://%v/PBIncr?group=%v&key=%v&delta=%d&initial=%d&ttl=%d",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+		delta,
+		initial,
+		ttl.Milliseconds(),
+	)
+	hsLogger.Debug("send incr request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		switch errorCode(res.Body) {
+		case http_resp.ErrorNotInteger.Error.ErrorCode:
+			return 0, fmt.Errorf("%w: key [%s]", mycache.ErrNotInteger, key)
+		case http_resp.ErrorCounterOverflow.Error.ErrorCode:
+			return 0, fmt.Errorf("%w: key [%s]", mycache.ErrCounterOverflow, key)
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return 0, fmt.Errorf("server return: %v", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		hsLogger.Error("reading response body: %v", err)
+		return 0, fmt.Errorf("reading response body: %v", err)
+	}
+	out := &pb.Response{}
+	if err = proto.Unmarshal(data, out); err != nil {
+		hsLogger.Error("decoding response body: %v", err)
+		return 0, fmt.Errorf("decoding response body: %v", err)
 	}
+	// 计算后的值以十进制保存在Value中
+	return strconv.ParseInt(string(out.Value), 10, 64)
+}
 
-	return out.Value, nil
+func (h *httpGetter) InvalidateTag(ctx context.Context, group string, tag string) (int, error) {
+	u := fmt.Sprintf(
+		"http://%v/PBTag?group=%v&tag=%v",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(tag),
+	)
+	hsLogger.Debug("send invalidate tag request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return 0, fmt.Errorf("server return: %v", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		hsLogger.Error("reading response body: %v", err)
+		return 0, fmt.Errorf("reading response body: %v", err)
+	}
+	out := &pb.CountResponse{}
+	if err = proto.Unmarshal(data, out); err != nil {
+		hsLogger.Error("decoding response body: %v", err)
+		return 0, fmt.Errorf("decoding response body: %v", err)
+	}
+	return int(out.Count), nil
+}
+
+func (h *httpGetter) DeletePattern(ctx context.Context, group string, pattern string) (int, error) {
+	u := fmt.Sprintf(
+		"http://%v/PBDelPattern?group=%v&pattern=%v",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(pattern),
+	)
+	hsLogger.Debug("send delete pattern request: %v", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		hsLogger.Error("server return: %v", res.Status)
+		return 0, fmt.Errorf("server return: %v", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		hsLogger.Error("reading response body: %v", err)
+		return 0, fmt.Errorf("reading response body: %v", err)
+	}
+	out := &pb.CountResponse{}
+	if err = proto.Unmarshal(data, out); err != nil {
+		hsLogger.Error("decoding response body: %v", err)
+		return 0, fmt.Errorf("decoding response body: %v", err)
+	}
+	return int(out.Count), nil
+}
+
+// errorCode 返回错误响应中的错误码,响应无法解析时返回空字符串
+func errorCode(body io.Reader) string {
+	var e http_resp.Err
+	if err := json.NewDecoder(body).Decode(&e); err != nil {
+		return ""
+	}
+	return e.ErrorCode
 }
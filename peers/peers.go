@@ -1,8 +1,15 @@
 package peers
 
+import (
+	"context"
+	"time"
+)
+
 // PeerPicker接口根据传入的key选择相应的节点PeerGetter
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// AllPeers 返回除自身以外的所有节点
+	AllPeers() []PeerGetter
 }
 
 // PeerServer接口
@@ -10,6 +17,7 @@ type PeerServer interface {
 	Set(peer string)
 	Del(peer string)
 	PickPeer(key string) (PeerGetter, bool)
+	AllPeers() []PeerGetter
 	Start(g GroupCache)
 }
 
@@ -18,7 +26,48 @@ type GroupCache interface {
 	RegisterPeers(peers PeerPicker)
 }
 
-// PeerGetter接口需要实现Get方法，从其他节点获取指定key的值
+// PeerGetter的方法都接收调用方的ctx,ctx的截止时间和取消会传递到远程节点.
+// PeerGetter接口需要实现Get方法，从其他节点获取指定key的值及其剩余存活时间,
+// Set方法，将key写入其他节点,以及Delete方法，删除其他节点中的key
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)
+	Get(ctx context.Context, group string, key string) ([]byte, time.Duration, error)
+	Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error
+	// SetWithTags 与Set相同,同时记录key的标签
+	SetWithTags(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string) error
+	// SetManifest 与SetWithTags相同,写入的值是大对象的分块清单
+	SetManifest(ctx context.Context, group string, key string, manifest []byte, ttl time.Duration, tags []string) error
+	Delete(ctx context.Context, group string, key string) error
+	// BatchGet 批量获取key,返回的结果与keys一一对应
+	BatchGet(ctx context.Context, group string, keys []string) ([]KeyResult, error)
+	// GetVersion 从负责key的节点获取key的值,剩余存活时间以及版本号
+	GetVersion(ctx context.Context, group string, key string) (KeyResult, error)
+	// CompareAndSwap 在key的版本号等于version时写入value,返回新的版本号
+	CompareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration) (uint64, error)
+	// CompareAndSwapManifest 与CompareAndSwap相同,写入的值是大对象的分块清单
+	CompareAndSwapManifest(ctx context.Context, group string, key string, version uint64, manifest []byte, ttl time.Duration) (uint64, error)
+	// Incr 将key中的整数加上delta,key不存在时以initial为初始值,返回计算后的值
+	Incr(ctx context.Context, group string, key string, delta, initial int64, ttl time.Duration) (int64, error)
+	// InvalidateTag 删除其他节点中带有tag的key,返回删除的key数量
+	InvalidateTag(ctx context.Context, group string, tag string) (int, error)
+	// DeletePattern 删除其他节点中匹配glob模式的key,返回删除的key数量
+	DeletePattern(ctx context.Context, group string, pattern string) (int, error)
+	// Scan 遍历其他节点中以prefix开头的key,返回的游标为空时表示遍历结束
+	Scan(ctx context.Context, group string, prefix string, cursor string, limit int) ([]KeyInfo, string, error)
+}
+
+// KeyResult 是批量获取中单个key的结果
+type KeyResult struct {
+	Key     string
+	Value   []byte
+	TTL     time.Duration
+	Version uint64 // 只有GetVersion返回
+	Err     error
+}
+
+// KeyInfo 是Scan返回的key的信息
+type KeyInfo struct {
+	Key  string
+	Size int           // 值实际占用的字节数
+	Hot  bool          // 是否在热数据区
+	TTL  time.Duration // 剩余存活时间,0表示永不过期
 }
@@ -1,10 +1,38 @@
 package rpc
 
 import (
+	mycache "TDKCache/cache"
+	"TDKCache/peers"
 	"TDKCache/peers/rpc/pool"
+	"TDKCache/service/conf"
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+const defaultRPCTimeout = 5000 // 默认RPC超时时间(毫秒)
+
+// 调用方没有设置截止时间时RPC请求的超时时间
+var rpcTimeout = func() time.Duration {
+	if v := conf.Conf.GetInt64("server.rpcTimeout"); v > 0 {
+		return time.Duration(v) * time.Millisecond
+	}
+	return defaultRPCTimeout * time.Millisecond
+}()
+
+// withTimeout 在ctx没有截止时间时加上默认的超时时间
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, rpcTimeout)
+}
+
 // RPC通信的客户端实现
 type RPCGetter struct {
 	addr string
@@ -24,33 +52,245 @@ func NewRPCGetter(addr string) *RPCGetter {
 	}
 }
 
-func (g *RPCGetter) Get(group string, key string) ([]byte, error) {
+// client 从连接池中获取连接,连接池在第一次使用时创建,使用完毕后调用release归还连接
+func (g *RPCGetter) client() (PeerServiceClient, func(), error) {
 	if g.pool == nil {
 		var err error
 		g.pool, err = pool.NewRPCPool(g.addr, pool.DefaultOptions)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	// 从连接池中获取连接
 	cc, err := g.pool.Get()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer cc.Close()
-
-	c := NewPeerServiceClient(cc.Value())
+	return NewPeerServiceClient(cc.Value()), func() { cc.Close() }, nil
+}
 
-	/*
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-	*/
+func (g *RPCGetter) Get(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	r, err := g.GetVersion(ctx, group, key)
+	return r.Value, r.TTL, err
+}
 
-	r, err := c.GetKey(context.Background(), &GetRequest{Group: group, Key: key})
+func (g *RPCGetter) GetVersion(ctx context.Context, group string, key string) (peers.KeyResult, error) {
+	c, release, err := g.client()
 	if err != nil {
+		return peers.KeyResult{}, err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.GetKey(ctx, &GetRequest{Group: group, Key: key})
+	if status.Code(err) == codes.NotFound {
+		// 远程节点确认key不存在
+		return peers.KeyResult{}, &mycache.NotFoundError{Key: key}
+	} else if err != nil {
 		rpcLogger.Error("could not get key: %v", err)
+		return peers.KeyResult{}, err
+	}
+
+	return peers.KeyResult{
+		Key:     key,
+		Value:   r.GetValue(),
+		TTL:     time.Duration(r.GetTtl()) * time.Millisecond,
+		Version: r.GetVersion(),
+	}, nil
+}
+
+func (g *RPCGetter) Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	return g.SetWithTags(ctx, group, key, value, ttl, nil)
+}
+
+func (g *RPCGetter) SetWithTags(ctx context.Context, group string, key string, value []byte, ttl time.Duration, tags []string) error {
+	return g.set(ctx, &SetRequest{Group: group, Key: key, Value: value, Ttl: ttl.Milliseconds(), Tags: tags})
+}
+
+func (g *RPCGetter) SetManifest(ctx context.Context, group string, key string, manifest []byte, ttl time.Duration, tags []string) error {
+	return g.set(ctx, &SetRequest{Group: group, Key: key, Value: manifest, Ttl: ttl.Milliseconds(), Tags: tags, Manifest: true})
+}
+
+func (g *RPCGetter) set(ctx context.Context, in *SetRequest) error {
+	c, release, err := g.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err = c.SetKey(ctx, in)
+	if err != nil {
+		rpcLogger.Error("could not set key: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (g *RPCGetter) Delete(ctx context.Context, group string, key string) error {
+	c, release, err := g.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err = c.DeleteKey(ctx, &DeleteRequest{Group: group, Key: key}); err != nil {
+		rpcLogger.Error("could not delete key: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (g *RPCGetter) BatchGet(ctx context.Context, group string, keys []string) ([]peers.KeyResult, error) {
+	c, release, err := g.client()
+	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.BatchGetKey(ctx, &BatchGetRequest{Group: group, Keys: keys})
+	if err != nil {
+		rpcLogger.Error("could not batch get keys: %v", err)
+		return nil, err
+	}
+
+	results := make([]peers.KeyResult, len(r.GetValues()))
+	for i, kv := range r.GetValues() {
+		results[i] = peers.KeyResult{Key: kv.GetKey()}
+		switch {
+		case kv.GetNotFound():
+			results[i].Err = &mycache.NotFoundError{Key: kv.GetKey()}
+		case kv.GetError() != "":
+			results[i].Err = errors.New(kv.GetError())
+		default:
+			results[i].Value = kv.GetValue()
+			results[i].TTL = time.Duration(kv.GetTtl()) * time.Millisecond
+		}
+	}
+	return results, nil
+}
+
+func (g *RPCGetter) Scan(ctx context.Context, group string, prefix string, cursor string, limit int) ([]peers.KeyInfo, string, error) {
+	c, release, err := g.client()
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.ScanKeys(ctx, &ScanRequest{Group: group, Prefix: prefix, Cursor: cursor, Limit: int32(limit)})
+	if err != nil {
+		rpcLogger.Error("could not scan keys: %v", err)
+		return nil, "", err
+	}
+
+	keys := make([]peers.KeyInfo, len(r.GetKeys()))
+	for i, k := range r.GetKeys() {
+		keys[i] = peers.KeyInfo{Key: k.GetKey(), Size: int(k.GetSize()), Hot: k.GetHot(), TTL: time.Duration(k.GetTtl()) * time.Millisecond}
+	}
+	return keys, r.GetCursor(), nil
+}
+
+func (g *RPCGetter) CompareAndSwap(ctx context.Context, group string, key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	return g.compareAndSwap(ctx, &CASRequest{Group: group, Key: key, Version: version, Value: value, Ttl: ttl.Milliseconds()})
+}
+
+func (g *RPCGetter) CompareAndSwapManifest(ctx context.Context, group string, key string, version uint64, manifest []byte, ttl time.Duration) (uint64, error) {
+	return g.compareAndSwap(ctx, &CASRequest{Group: group, Key: key, Version: version, Value: manifest, Ttl: ttl.Milliseconds(), Manifest: true})
+}
+
+func (g *RPCGetter) compareAndSwap(ctx context.Context, in *CASRequest) (uint64, error) {
+	c, release, err := g.client()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.CompareAndSwap(ctx, in)
+	if status.Code(err) == codes.Aborted {
+		// 远程节点中key的版本号已经改变
+		return 0, fmt.Errorf("%w: %s", mycache.ErrVersionConflict, trimCause(err, mycache.ErrVersionConflict))
+	} else if err != nil {
+		rpcLogger.Error("could not swap key: %v", err)
+		return 0, err
+	}
+	return r.GetVersion(), nil
+}
+
+func (g *RPCGetter) Incr(ctx context.Context, group string, key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	c, release, err := g.client()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.Incr(ctx, &IncrRequest{Group: group, Key: key, Delta: delta, Initial: initial, Ttl: ttl.Milliseconds()})
+	switch status.Code(err) {
+	case codes.OK:
+		return r.GetValue(), nil
+	case codes.FailedPrecondition:
+		return 0, fmt.Errorf("%w: %s", mycache.ErrNotInteger, trimCause(err, mycache.ErrNotInteger))
+	case codes.OutOfRange:
+		return 0, fmt.Errorf("%w: %s", mycache.ErrCounterOverflow, trimCause(err, mycache.ErrCounterOverflow))
+	}
+	rpcLogger.Error("could not incr key: %v", err)
+	return 0, err
+}
+
+func (g *RPCGetter) InvalidateTag(ctx context.Context, group string, tag string) (int, error) {
+	c, release, err := g.client()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.InvalidateTag(ctx, &InvalidateTagRequest{Group: group, Tag: tag})
+	if err != nil {
+		rpcLogger.Error("could not invalidate tag: %v", err)
+		return 0, err
+	}
+	return int(r.GetCount()), nil
+}
+
+func (g *RPCGetter) DeletePattern(ctx context.Context, group string, pattern string) (int, error) {
+	c, release, err := g.client()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	r, err := c.DeletePattern(ctx, &DeletePatternRequest{Group: group, Pattern: pattern})
+	if err != nil {
+		rpcLogger.Error("could not delete pattern: %v", err)
+		return 0, err
+	}
+	return int(r.GetCount()), nil
+}
 
-	return r.GetValue(), nil
+// trimCause 去掉远程错误信息中cause的描述,用于在本地重新包装cause
+func trimCause(err error, cause error) string {
+	return strings.TrimPrefix(status.Convert(err).Message(), cause.Error()+": ")
 }
@@ -23,6 +23,14 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PeerServiceClient interface {
 	GetKey(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	SetKey(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	DeleteKey(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	BatchGetKey(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error)
+	ScanKeys(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error)
+	CompareAndSwap(ctx context.Context, in *CASRequest, opts ...grpc.CallOption) (*CASResponse, error)
+	Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error)
+	InvalidateTag(ctx context.Context, in *InvalidateTagRequest, opts ...grpc.CallOption) (*InvalidateTagResponse, error)
+	DeletePattern(ctx context.Context, in *DeletePatternRequest, opts ...grpc.CallOption) (*DeletePatternResponse, error)
 }
 
 type peerServiceClient struct {
@@ -42,11 +50,91 @@ func (c *peerServiceClient) GetKey(ctx context.Context, in *GetRequest, opts ...
 	return out, nil
 }
 
+func (c *peerServiceClient) SetKey(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/SetKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) DeleteKey(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/DeleteKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) BatchGetKey(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error) {
+	out := new(BatchGetResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/BatchGetKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) ScanKeys(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error) {
+	out := new(ScanResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/ScanKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) CompareAndSwap(ctx context.Context, in *CASRequest, opts ...grpc.CallOption) (*CASResponse, error) {
+	out := new(CASResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/CompareAndSwap", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error) {
+	out := new(IncrResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/Incr", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) InvalidateTag(ctx context.Context, in *InvalidateTagRequest, opts ...grpc.CallOption) (*InvalidateTagResponse, error) {
+	out := new(InvalidateTagResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/InvalidateTag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) DeletePattern(ctx context.Context, in *DeletePatternRequest, opts ...grpc.CallOption) (*DeletePatternResponse, error) {
+	out := new(DeletePatternResponse)
+	err := c.cc.Invoke(ctx, "/rpc.PeerService/DeletePattern", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PeerServiceServer is the server API for PeerService service.
 // All implementations must embed UnimplementedPeerServiceServer
 // for forward compatibility
 type PeerServiceServer interface {
 	GetKey(context.Context, *GetRequest) (*GetResponse, error)
+	SetKey(context.Context, *SetRequest) (*SetResponse, error)
+	DeleteKey(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	BatchGetKey(context.Context, *BatchGetRequest) (*BatchGetResponse, error)
+	ScanKeys(context.Context, *ScanRequest) (*ScanResponse, error)
+	CompareAndSwap(context.Context, *CASRequest) (*CASResponse, error)
+	Incr(context.Context, *IncrRequest) (*IncrResponse, error)
+	InvalidateTag(context.Context, *InvalidateTagRequest) (*InvalidateTagResponse, error)
+	DeletePattern(context.Context, *DeletePatternRequest) (*DeletePatternResponse, error)
 	mustEmbedUnimplementedPeerServiceServer()
 }
 
@@ -57,6 +145,30 @@ type UnimplementedPeerServiceServer struct {
 func (UnimplementedPeerServiceServer) GetKey(context.Context, *GetRequest) (*GetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetKey not implemented")
 }
+func (UnimplementedPeerServiceServer) SetKey(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetKey not implemented")
+}
+func (UnimplementedPeerServiceServer) DeleteKey(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteKey not implemented")
+}
+func (UnimplementedPeerServiceServer) BatchGetKey(context.Context, *BatchGetRequest) (*BatchGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetKey not implemented")
+}
+func (UnimplementedPeerServiceServer) ScanKeys(context.Context, *ScanRequest) (*ScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScanKeys not implemented")
+}
+func (UnimplementedPeerServiceServer) CompareAndSwap(context.Context, *CASRequest) (*CASResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSwap not implemented")
+}
+func (UnimplementedPeerServiceServer) Incr(context.Context, *IncrRequest) (*IncrResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedPeerServiceServer) InvalidateTag(context.Context, *InvalidateTagRequest) (*InvalidateTagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InvalidateTag not implemented")
+}
+func (UnimplementedPeerServiceServer) DeletePattern(context.Context, *DeletePatternRequest) (*DeletePatternResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeletePattern not implemented")
+}
 func (UnimplementedPeerServiceServer) mustEmbedUnimplementedPeerServiceServer() {}
 
 // UnsafePeerServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +200,150 @@ func _PeerService_GetKey_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PeerService_SetKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).SetKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/SetKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).SetKey(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_DeleteKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).DeleteKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/DeleteKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).DeleteKey(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_BatchGetKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).BatchGetKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/BatchGetKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).BatchGetKey(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_ScanKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).ScanKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/ScanKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).ScanKeys(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_CompareAndSwap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CASRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).CompareAndSwap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/CompareAndSwap",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).CompareAndSwap(ctx, req.(*CASRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/Incr",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).Incr(ctx, req.(*IncrRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_InvalidateTag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvalidateTagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).InvalidateTag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/InvalidateTag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).InvalidateTag(ctx, req.(*InvalidateTagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_DeletePattern_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePatternRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).DeletePattern(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.PeerService/DeletePattern",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).DeletePattern(ctx, req.(*DeletePatternRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PeerService_ServiceDesc is the grpc.ServiceDesc for PeerService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,6 +355,38 @@ var PeerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetKey",
 			Handler:    _PeerService_GetKey_Handler,
 		},
+		{
+			MethodName: "SetKey",
+			Handler:    _PeerService_SetKey_Handler,
+		},
+		{
+			MethodName: "DeleteKey",
+			Handler:    _PeerService_DeleteKey_Handler,
+		},
+		{
+			MethodName: "BatchGetKey",
+			Handler:    _PeerService_BatchGetKey_Handler,
+		},
+		{
+			MethodName: "ScanKeys",
+			Handler:    _PeerService_ScanKeys_Handler,
+		},
+		{
+			MethodName: "CompareAndSwap",
+			Handler:    _PeerService_CompareAndSwap_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _PeerService_Incr_Handler,
+		},
+		{
+			MethodName: "InvalidateTag",
+			Handler:    _PeerService_InvalidateTag_Handler,
+		},
+		{
+			MethodName: "DeletePattern",
+			Handler:    _PeerService_DeletePattern_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "peers/rpc/peers.proto",
@@ -8,13 +8,16 @@ import (
 	"TDKCache/service/consistenthash"
 	"TDKCache/service/log"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -78,6 +81,19 @@ func (s *RPCServer) PickPeer(key string) (peers.PeerGetter, bool) {
 	return nil, false
 }
 
+func (s *RPCServer) AllPeers() []peers.PeerGetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make([]peers.PeerGetter, 0, len(s.getters))
+	for peer, getter := range s.getters {
+		if peer != s.self {
+			all = append(all, getter)
+		}
+	}
+	return all
+}
+
 func (s *RPCServer) listenAndServe() {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	if err != nil {
@@ -145,6 +161,28 @@ func (s *RPCServer) Start(g peers.GroupCache) {
 	s.listenAndServe()
 }
 
+// rpcError 将Group返回的错误转换为gRPC状态,
+// 使客户端能够区分key不存在以及请求被取消或超时
+func rpcError(err error) error {
+	switch {
+	case mycache.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, mycache.ErrInvalidCursor), errors.Is(err, mycache.ErrInvalidPattern), errors.Is(err, mycache.ErrInvalidManifest),
+		errors.Is(err, mycache.ErrReservedKey):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, mycache.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, mycache.ErrNotInteger):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, mycache.ErrCounterOverflow):
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	rpcLogger.Error("Internal error: %v", err)
+	return fmt.Errorf("internal error: %v", err)
+}
+
 func (s *RPCServer) GetKey(ctx context.Context, in *GetRequest) (*GetResponse, error) {
 	groupName := in.GetGroup()
 	if groupName == "" {
@@ -164,11 +202,240 @@ func (s *RPCServer) GetKey(ctx context.Context, in *GetRequest) (*GetResponse, e
 		return nil, fmt.Errorf("no such group: %s", groupName)
 	}
 
-	view, err := group.Get(key)
+	// 本节点负责该key,不需要查找热点缓存
+	res := group.GetVersioned(ctx, key)
+	if res.Err != nil {
+		return nil, rpcError(res.Err)
+	}
+
+	// 响应编码时只读取数据,不需要拷贝
+	return &GetResponse{Value: res.Value.UnsafeBytes(), Ttl: res.TTL.Milliseconds(), Version: res.Version}, nil
+}
+
+func (s *RPCServer) SetKey(ctx context.Context, in *SetRequest) (*SetResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	key := in.GetKey()
+	if key == "" {
+		rpcLogger.Error("lack of necessary param [key]")
+		return nil, fmt.Errorf("lack of necessary param [key]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	ttl := time.Duration(in.GetTtl()) * time.Millisecond
+	set := group.SetLocallyWithTags
+	if in.GetManifest() {
+		set = group.SetManifestLocally
+	}
+	if err := set(key, in.GetValue(), ttl, in.GetTags()); err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &SetResponse{}, nil
+}
+
+func (s *RPCServer) DeleteKey(ctx context.Context, in *DeleteRequest) (*DeleteResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	key := in.GetKey()
+	if key == "" {
+		rpcLogger.Error("lack of necessary param [key]")
+		return nil, fmt.Errorf("lack of necessary param [key]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	if err := group.DeleteLocally(key); err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &DeleteResponse{}, nil
+}
+
+func (s *RPCServer) BatchGetKey(ctx context.Context, in *BatchGetRequest) (*BatchGetResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	results := group.GetMultiContext(ctx, in.GetKeys())
+	values := make([]*KeyValue, len(results))
+	for i, res := range results {
+		kv := &KeyValue{Key: res.Key}
+		switch {
+		case mycache.IsNotFound(res.Err):
+			kv.NotFound = true
+		case res.Err != nil:
+			kv.Error = res.Err.Error()
+		default:
+			kv.Value = res.Value.UnsafeBytes()
+			kv.Ttl = res.TTL.Milliseconds()
+		}
+		values[i] = kv
+	}
+
+	return &BatchGetResponse{Values: values}, nil
+}
+
+func (s *RPCServer) ScanKeys(ctx context.Context, in *ScanRequest) (*ScanResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	keys, cursor, err := group.Scan(in.GetPrefix(), in.GetCursor(), int(in.GetLimit()))
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	infos := make([]*KeyInfo, len(keys))
+	for i, k := range keys {
+		infos[i] = &KeyInfo{Key: k.Key, Size: int64(k.Size), Hot: k.Hot, Ttl: k.TTL.Milliseconds()}
+	}
+	return &ScanResponse{Keys: infos, Cursor: cursor}, nil
+}
+
+func (s *RPCServer) CompareAndSwap(ctx context.Context, in *CASRequest) (*CASResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	key := in.GetKey()
+	if key == "" {
+		rpcLogger.Error("lack of necessary param [key]")
+		return nil, fmt.Errorf("lack of necessary param [key]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	ttl := time.Duration(in.GetTtl()) * time.Millisecond
+	cas := group.CompareAndSwapLocally
+	if in.GetManifest() {
+		cas = group.CompareAndSwapManifestLocally
+	}
+	version, err := cas(key, in.GetVersion(), in.GetValue(), ttl)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &CASResponse{Version: version}, nil
+}
+
+func (s *RPCServer) Incr(ctx context.Context, in *IncrRequest) (*IncrResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	key := in.GetKey()
+	if key == "" {
+		rpcLogger.Error("lack of necessary param [key]")
+		return nil, fmt.Errorf("lack of necessary param [key]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	ttl := time.Duration(in.GetTtl()) * time.Millisecond
+	n, err := group.IncrLocally(key, in.GetDelta(), in.GetInitial(), ttl)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &IncrResponse{Value: n}, nil
+}
+
+func (s *RPCServer) InvalidateTag(ctx context.Context, in *InvalidateTagRequest) (*InvalidateTagResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	tag := in.GetTag()
+	if tag == "" {
+		rpcLogger.Error("lack of necessary param [tag]")
+		return nil, fmt.Errorf("lack of necessary param [tag]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	n, err := group.InvalidateTagLocally(tag)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &InvalidateTagResponse{Count: int64(n)}, nil
+}
+
+func (s *RPCServer) DeletePattern(ctx context.Context, in *DeletePatternRequest) (*DeletePatternResponse, error) {
+	groupName := in.GetGroup()
+	if groupName == "" {
+		rpcLogger.Error("lack of necessary param [group]")
+		return nil, fmt.Errorf("lack of necessary param [group]")
+	}
+
+	pattern := in.GetPattern()
+	if pattern == "" {
+		rpcLogger.Error("lack of necessary param [pattern]")
+		return nil, fmt.Errorf("lack of necessary param [pattern]")
+	}
+
+	group := mycache.GetGroup(groupName)
+	if group == nil {
+		rpcLogger.Error("no such group: %s", groupName)
+		return nil, fmt.Errorf("no such group: %s", groupName)
+	}
+
+	n, err := group.DeletePatternLocally(pattern)
 	if err != nil {
-		rpcLogger.Error("Internal error: %v", err)
-		return nil, fmt.Errorf("internal error: %v", err)
+		return nil, rpcError(err)
 	}
 
-	return &GetResponse{Value: view.ByteSlice()}, nil
+	return &DeletePatternResponse{Count: int64(n)}, nil
 }
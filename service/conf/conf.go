@@ -62,3 +62,7 @@ func (c *config) GetInt64(key string) int64 {
 func (c *config) GetUint32(key string) uint32 {
 	return c.viper.GetUint32(key)
 }
+
+func (c *config) GetFloat64(key string) float64 {
+	return c.viper.GetFloat64(key)
+}
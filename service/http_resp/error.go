@@ -74,4 +74,39 @@ var (
 			ErrorCode: "008",
 		},
 	}
+	ErrorKeyUnexists = ErrorResponse{
+		HttpSC: 404,
+		Error: Err{
+			Error:     "No such key",
+			ErrorCode: "009",
+		},
+	}
+	ErrorGroupExists = ErrorResponse{
+		HttpSC: 409,
+		Error: Err{
+			Error:     "Group already exists",
+			ErrorCode: "010",
+		},
+	}
+	ErrorVersionConflict = ErrorResponse{
+		HttpSC: 409,
+		Error: Err{
+			Error:     "Version conflict",
+			ErrorCode: "011",
+		},
+	}
+	ErrorNotInteger = ErrorResponse{
+		HttpSC: 409,
+		Error: Err{
+			Error:     "Value is not an integer",
+			ErrorCode: "012",
+		},
+	}
+	ErrorCounterOverflow = ErrorResponse{
+		HttpSC: 409,
+		Error: Err{
+			Error:     "Increment or decrement would overflow",
+			ErrorCode: "013",
+		},
+	}
 )